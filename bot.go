@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -11,7 +12,8 @@ import (
 	"github.com/PulseDevelopmentGroup/Build-A-Bot/config"
 	"github.com/PulseDevelopmentGroup/Build-A-Bot/log"
 	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
-	"github.com/patrickmn/go-cache"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/reload"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/storage"
 
 	"github.com/bwmarrin/discordgo"
 	goenv "github.com/caarlos0/env/v6"
@@ -19,17 +21,29 @@ import (
 )
 
 type environment struct {
-	Token     string `env:"BOT_TOKEN"`
-	Debug     bool   `env:"DEBUG" envDefault:"false"`
-	DataDir   string `env:"DATA_DIR" envDefault:"data/"`
-	ConfigURL string `env:"CONFIG_URL"`
-	Fuzzy     bool   `env:"USE_FUZZY" envDefault:"false"`
+	Token      string `env:"BOT_TOKEN"`
+	Debug      bool   `env:"DEBUG" envDefault:"false"`
+	DataDir    string `env:"DATA_DIR" envDefault:"data/"`
+	ConfigURL  string `env:"CONFIG_URL"`
+	Fuzzy      bool   `env:"USE_FUZZY" envDefault:"false"`
+	Slash      bool   `env:"USE_SLASH" envDefault:"false"`
+	SlashGuild string `env:"SLASH_GUILD"`
+	Storage    string `env:"STORAGE" envDefault:"file"`
+
+	Owners         []string      `env:"OWNER_IDS" envSeparator:","`
+	ReloadInterval time.Duration `env:"CONFIG_RELOAD_INTERVAL" envDefault:"5m"`
+	FetchTimeout   time.Duration `env:"CONFIG_TIMEOUT" envDefault:"10s"`
+	FetchRetries   int           `env:"CONFIG_RETRIES" envDefault:"2"`
+	FetchBackoff   time.Duration `env:"CONFIG_BACKOFF" envDefault:"1s"`
+	PublicKey      string        `env:"CONFIG_PUBLIC_KEY"`
 }
 
 var (
-	env  = environment{}
-	cfg  *config.BotConfig
-	logs *log.Logs
+	env        = environment{}
+	cfg        *config.BotConfig
+	configPath string
+	includeDir string
+	logs       *log.Logs
 
 	prefix = "!"
 )
@@ -42,14 +56,47 @@ func init() {
 	}
 
 	/* Check if URL is being specified */
-	path := env.DataDir + "config.json"
+	configPath = env.DataDir + "config.json"
+	for _, name := range []string{"config.yaml", "config.yml", "config.toml"} {
+		/* Other formats are only used if there's no config.json */
+		if _, err := os.Stat(configPath); err == nil {
+			break
+		}
+		if _, err := os.Stat(env.DataDir + name); err == nil {
+			configPath = env.DataDir + name
+		}
+	}
 	if len(env.ConfigURL) > 0 {
-		path = env.ConfigURL
+		configPath = env.ConfigURL
 	}
 
+	/* Files in DATA_DIR/config.d are merged into the config */
+	includeDir = filepath.Join(env.DataDir, config.IncludeDirName)
+
+	/* Remote configs are cached in DATA_DIR/cache in case they can't be
+	   fetched later, and must be signed if a public key is given */
+	remote := config.RemoteOptions{
+		Timeout:  env.FetchTimeout,
+		Retries:  env.FetchRetries,
+		Backoff:  env.FetchBackoff,
+		CacheDir: filepath.Join(env.DataDir, "cache"),
+	}
+	if len(env.PublicKey) > 0 {
+		key, err := config.ParsePublicKey(env.PublicKey)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		remote.PublicKey = key
+	}
+	config.SetRemoteOptions(remote)
+
+	/* Run a command line tool (e.g. validate-config) instead if asked to */
+	runCLI(os.Args[1:])
+
 	/* Parse config */
 	var err error
-	cfg, err = config.Get(path)
+	cfg, err = config.Load(configPath, includeDir)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -57,6 +104,10 @@ func init() {
 
 	/* Define logging setup */
 	logs = log.New(env.Debug)
+
+	for _, w := range cfg.Warnings {
+		logs.Config.Warn("Config problem: " + w.String())
+	}
 }
 
 func main() {
@@ -68,48 +119,97 @@ func main() {
 	}
 	logs.Primary.Info("Bot started")
 
-	/* Initialize Mux */
-	mux, err := multiplexer.New(prefix)
+	/* Message content is a privileged intent, but needed for text commands */
+	dg.Identify.Intents = discordgo.IntentsAllWithoutPrivileged |
+		discordgo.IntentMessageContent
+
+	/* Initialize Mux, using the prefixes from the config file if there are any */
+	prefixes := cfg.Prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{prefix}
+	}
+
+	mux, err := multiplexer.New(prefixes...)
 	if err != nil {
 		logs.Primary.WithError(err).Fatalf("Unable to create multixplexer")
 	}
 
+	/* Setup storage for commands to keep data in, either on disk in the data
+	   directory or just in memory */
+	var store storage.Store
+	if env.Storage == "memory" {
+		store = storage.NewMemory()
+	} else {
+		store, err = storage.OpenFile(filepath.Join(env.DataDir, "storage"))
+		if err != nil {
+			logs.Primary.WithError(err).Fatal("Unable to open storage")
+		}
+	}
+	defer store.Close()
+	mux.SetStorage(store)
+
+	/* Setup config reloading */
+	reloader := reload.New(configPath, cfg, mux, logs)
+	reloader.URLInterval = env.ReloadInterval
+	reloader.Owners = env.Owners
+
 	/* Use the logging middleware with the multiplexer */
 	mux.UseMiddleware(logs.MuxMiddleware)
-
-	/* Set Permissions */
-	mux.SetPermissions(cfg.Permissions)
+	mux.SetLogger(logs.Multiplexer)
 
 	/* Setup Errors */
 	mux.SetErrors(&multiplexer.ErrorTexts{
-		CommandNotFound: "Command not found.",
-		NoPermissions:   "You do not have permissions to execute that command.",
-		RateLimited:     "You've used this command too many times, wait a bit and try again.",
+		CommandNotFound:  "Command not found.",
+		NoPermissions:    "You do not have permissions to execute that command.",
+		RateLimited:      "You've used this command too many times, try again in %s.",
+		InvalidArguments: "Those arguments don't look right.",
+
+		MemberMissingPermissions: "You need these permissions to use that command: %s",
+		BotMissingPermissions:    "I need these permissions to do that: %s",
+
+		InternalError: "Something went wrong, try again later.",
 	})
 
 	/* === Register all the things === */
 
 	/* Register the commands with the multiplexer*/
-	mux.Register(
+	err = mux.Register(
 		command.Example{
 			Command:  "example",
 			HelpText: "Quick one-liner about what the command does",
 
 			/* Example rate limiter. Prevents a single user from executing the command
 			   more than 5 times in a minute */
-			RateLimitMax: 5,
-			RateLimitDB:  cache.New(time.Minute*1, time.Minute*1),
+			RateLimiter: multiplexer.NewSlidingWindow(
+				5, time.Minute, multiplexer.ScopeUser,
+			),
 
 			Logger: logs,
 		},
+		&command.Help{
+			Command:  "help",
+			HelpText: "Lists commands, or shows more about a specific one",
+		},
+		command.Reload{
+			Command:  "reload",
+			HelpText: "Reloads the config file",
+			Reloader: reloader,
+			Logger:   logs,
+		},
+		command.Guild{
+			Command:  "guild",
+			HelpText: "Shows or changes this guild's config",
+			Reloader: reloader,
+			Logger:   logs,
+		},
 	)
+	if err != nil {
+		logs.Primary.WithError(err).Warn("Problem registering commands")
+	}
 
-	for k := range cfg.SimpleCommands {
-		mux.RegisterSimple(multiplexer.SimpleCommand{
-			Command:  k,
-			Content:  cfg.SimpleCommands[k],
-			HelpText: "This is a simple command",
-		})
+	/* Set permissions and register simple commands from the config */
+	if err := reloader.Apply(cfg); err != nil {
+		logs.Primary.WithError(err).Warn("Problem registering simple commands")
 	}
 
 	/* Configure multiplexer options */
@@ -118,6 +218,8 @@ func main() {
 		IgnoreBots:       true,
 		IgnoreNonDefault: true,
 		IgnoreEmpty:      true,
+		MentionPrefix:    true,
+		AdminOverride:    true,
 	})
 
 	/* Initialize the commands */
@@ -131,6 +233,7 @@ func main() {
 
 	/* Handle commands and start DiscordGo */
 	dg.AddHandler(mux.Handle)
+	dg.AddHandler(mux.HandleInteraction)
 
 	err = dg.Open()
 	if err != nil {
@@ -140,18 +243,24 @@ func main() {
 		return
 	}
 
+	/* Publish the commands as slash commands. Publishing to a single guild
+	   (SLASH_GUILD) shows up instantly, which is handy for development */
+	if env.Slash {
+		if err := mux.PublishCommands(dg, env.SlashGuild); err != nil {
+			logs.Primary.WithError(err).Error("Problem publishing slash commands")
+		}
+	}
+
 	/* Set a fun status message */
 
 	/*
 		idle := 0
 		dg.UpdateStatusComplex(discordgo.UpdateStatusData{
 			IdleSince: &idle,
-			Game: &discordgo.Game{
-				Name: "you",
-				Type: discordgo.GameTypeWatching,
-				Assets: discordgo.Assets{
-					LargeImageID: "watching",
-					LargeText:    "Watching...",
+			Activities: []*discordgo.Activity{
+				{
+					Name: "you",
+					Type: discordgo.ActivityTypeWatching,
 				},
 			},
 			Status: "online",
@@ -160,6 +269,10 @@ func main() {
 
 	defer dg.Close()
 
+	/* Reload the config on SIGHUP or when it changes */
+	reloader.Watch()
+	defer reloader.Stop()
+
 	/* Wait for interrupt */
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGTERM)
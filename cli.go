@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/config"
+)
+
+// cliCommands are the commands which can be run from the command line (e.g.
+// `bot validate-config`) in place of starting the bot. Each returns the exit
+// code to use.
+var cliCommands = map[string]func(args []string) int{
+	"validate-config": validateConfig,
+	"sign":            signConfig,
+	"keygen":          generateKeys,
+}
+
+// runCLI runs the command named in the arguments, if there is one, and exits
+// with its exit code.
+func runCLI(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		var names []string
+		for name := range cliCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(os.Stderr, "Unknown command %q. Available commands:\n", args[0])
+		for _, name := range names {
+			fmt.Fprintln(os.Stderr, "  "+name)
+		}
+		os.Exit(2)
+	}
+
+	os.Exit(cmd(args[1:]))
+}
+
+// validateConfig checks the configs at the paths (or URLs) given, or the one
+// the bot would load if none are given, and prints every problem found in them
+// and the files they include. Exits with 1 if any of the configs can't be
+// loaded.
+func validateConfig(args []string) int {
+	paths := args
+	if len(paths) == 0 {
+		paths = []string{configPath}
+	}
+
+	code := 0
+	for _, path := range paths {
+		dir := config.DefaultIncludeDir(path)
+		if path == configPath {
+			dir = includeDir
+		}
+
+		problems, err := config.Check(path, dir)
+		if err != nil {
+			fmt.Printf("%s: unable to read config: %s\n", path, err)
+			code = 1
+			continue
+		}
+
+		valid := true
+		for _, p := range problems {
+			fmt.Println(p)
+			if !p.Warning {
+				valid = false
+			}
+		}
+
+		if !valid {
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: OK\n", path)
+	}
+
+	return code
+}
+
+// signConfig writes a detached signature for each config file given, next to
+// it (e.g. config.json.sig). The private key is read from the file passed with
+// -key, or from the CONFIG_SIGNING_KEY variable.
+func signConfig(args []string) int {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	keyFile := flags.String("key", "", "file containing the base64 private key")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sign [-key file] config.json...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		if err == nil {
+			flags.Usage()
+		}
+		return 2
+	}
+
+	encoded := os.Getenv("CONFIG_SIGNING_KEY")
+	if len(*keyFile) > 0 {
+		data, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		encoded = string(data)
+	}
+	if len(encoded) == 0 {
+		fmt.Fprintln(os.Stderr, "No private key given, use -key or CONFIG_SIGNING_KEY")
+		return 2
+	}
+
+	key, err := config.ParsePrivateKey(encoded)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, path := range flags.Args() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		out := path + config.SignatureExt
+		sig := config.Sign(data, key) + "\n"
+		if err := ioutil.WriteFile(out, []byte(sig), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s: signed, wrote %s\n", path, out)
+	}
+
+	return 0
+}
+
+// generateKeys prints a new key pair for signing configs.
+func generateKeys(args []string) int {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	enc := base64.StdEncoding
+	fmt.Println("CONFIG_PUBLIC_KEY=" + enc.EncodeToString(pub))
+	fmt.Println("CONFIG_SIGNING_KEY=" + enc.EncodeToString(priv.Seed()))
+	return 0
+}
@@ -5,7 +5,6 @@ import (
 
 	"github.com/PulseDevelopmentGroup/Build-A-Bot/log"
 	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
-	"github.com/patrickmn/go-cache"
 )
 
 // Example is a command
@@ -14,8 +13,7 @@ type Example struct {
 	HelpText string
 
 	/* Optional rate-limiting settings */
-	RateLimitMax int
-	RateLimitDB  *cache.Cache
+	RateLimiter multiplexer.RateLimiter
 
 	/* Anything that needs passed to a given command can be added here */
 	Logger *log.Logs // For example, the Logger
@@ -53,7 +51,6 @@ func (c Example) Settings() *multiplexer.CommandSettings {
 		HelpText: c.HelpText,
 
 		/* Optional rate limiting */
-		RateLimitMax: c.RateLimitMax,
-		RateLimitDB:  c.RateLimitDB,
+		RateLimiter: c.RateLimiter,
 	}
 }
@@ -0,0 +1,424 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/config"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/log"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/reload"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Guild lets guild admins (members with the Manage Server permission) view and
+// edit the config of their guild at runtime, e.g. `!guild disable example`.
+// Edits are kept in storage and replace the guild's entry in the config file
+// until `!guild reset` is used.
+type Guild struct {
+	Command  string
+	HelpText string
+
+	Reloader *reload.Reloader
+	Logger   *log.Logs
+}
+
+/* The longest message Discord allows */
+const maxMessage = 2000
+
+// guildSubcommand is a subcommand of Guild which changes the guild's config.
+// The edit function is given a copy of the guild's current config, and
+// returns the reply to send (if any) and whether or not the config should be
+// saved.
+type guildSubcommand struct {
+	Guild
+
+	command, helpText string
+	arguments         []multiplexer.Argument
+	edit              func(*multiplexer.Context, *config.GuildConfig) (string, bool)
+}
+
+// Init is called by the multiplexer before the bot starts to initialize any
+// variables the command needs.
+func (c Guild) Init(m *multiplexer.Mux) {
+	// Nothing to init
+}
+
+// Handle lists the subcommands, since the command does nothing on its own.
+func (c Guild) Handle(ctx *multiplexer.Context) {
+	c.group().Handle(ctx)
+}
+
+// HandleHelp lists the subcommands along with their help text.
+func (c Guild) HandleHelp(ctx *multiplexer.Context) {
+	c.group().HandleHelp(ctx)
+}
+
+// Settings is called by the multiplexer on startup to process any settings
+// associated with that command.
+func (c Guild) Settings() *multiplexer.CommandSettings {
+	s := c.group().Settings()
+	s.Category = "Admin"
+	return s
+}
+
+// Init is called by the multiplexer before the bot starts.
+func (c guildSubcommand) Init(m *multiplexer.Mux) {
+	// Nothing to init
+}
+
+// Handle edits the config of the guild the command was used in, saving it if
+// anything changed.
+func (c guildSubcommand) Handle(ctx *multiplexer.Context) {
+	guildID := ctx.Message.GuildID
+	if len(guildID) == 0 {
+		ctx.ChannelSend("This command can only be used in a guild.")
+		return
+	}
+
+	g, _, err := c.Reloader.GuildConfig(guildID)
+	if err != nil {
+		c.Logger.CmdErr(ctx, err, "Unable to load this guild's config.")
+		return
+	}
+
+	if g == nil {
+		g = &config.GuildConfig{}
+	}
+	g = g.Copy()
+
+	reply, save := c.edit(ctx, g)
+	if save {
+		if err := c.Reloader.SetGuildConfig(guildID, g); err != nil {
+			c.Logger.CmdErr(ctx, err, "Unable to save this guild's config.")
+			return
+		}
+	}
+
+	if len(reply) != 0 {
+		ctx.ChannelSend(reply)
+	}
+}
+
+// HandleHelp explains what the subcommand does.
+func (c guildSubcommand) HandleHelp(ctx *multiplexer.Context) {
+	ctx.ChannelSend(c.helpText)
+}
+
+// Settings returns the settings of the subcommand. Only members who can manage
+// the guild can use it.
+func (c guildSubcommand) Settings() *multiplexer.CommandSettings {
+	return &multiplexer.CommandSettings{
+		Command:           c.command,
+		HelpText:          c.helpText,
+		Arguments:         c.arguments,
+		MemberPermissions: discordgo.PermissionManageServer,
+	}
+}
+
+// group builds the subcommands of the command.
+func (c Guild) group() multiplexer.CommandGroup {
+	return multiplexer.CommandGroup{
+		Command:  c.Command,
+		HelpText: c.HelpText,
+		Subcommands: []multiplexer.Command{
+			guildSubcommand{
+				Guild:    c,
+				command:  "show",
+				helpText: "Shows this guild's config",
+				edit:     c.show,
+			},
+			guildSubcommand{
+				Guild:    c,
+				command:  "set",
+				helpText: "Replaces this guild's config with the JSON given",
+				arguments: []multiplexer.Argument{
+					{Name: "json", Type: multiplexer.ArgString, Required: true, Variadic: true},
+				},
+				edit: c.set,
+			},
+			guildSubcommand{
+				Guild:   c,
+				command: "reset",
+				helpText: "Discards any changes made to this guild's config " +
+					"with this command",
+				edit: c.reset,
+			},
+			guildSubcommand{
+				Guild:   c,
+				command: "prefix",
+				helpText: "Sets this guild's prefixes, or goes back to the " +
+					"default ones if none are given",
+				arguments: []multiplexer.Argument{
+					{Name: "prefixes", Type: multiplexer.ArgString, Variadic: true},
+				},
+				edit: c.prefix,
+			},
+			guildSubcommand{
+				Guild:   c,
+				command: "simple",
+				helpText: "Adds a simple command to this guild, or removes it " +
+					"if no content is given",
+				arguments: []multiplexer.Argument{
+					{Name: "name", Type: multiplexer.ArgString, Required: true},
+					{Name: "content", Type: multiplexer.ArgString, Variadic: true},
+				},
+				edit: c.simple,
+			},
+			guildSubcommand{
+				Guild:    c,
+				command:  "disable",
+				helpText: "Stops a command from being used in this guild",
+				arguments: []multiplexer.Argument{
+					{Name: "command", Type: multiplexer.ArgString, Required: true, Variadic: true},
+				},
+				edit: c.disable,
+			},
+			guildSubcommand{
+				Guild:    c,
+				command:  "enable",
+				helpText: "Allows a disabled command to be used in this guild again",
+				arguments: []multiplexer.Argument{
+					{Name: "command", Type: multiplexer.ArgString, Required: true, Variadic: true},
+				},
+				edit: c.enable,
+			},
+		},
+	}
+}
+
+// show replies with the guild's config, as it would be written in the config
+// file.
+func (c Guild) show(
+	ctx *multiplexer.Context, g *config.GuildConfig,
+) (string, bool) {
+	_, edited, err := c.Reloader.GuildConfig(ctx.Message.GuildID)
+	if err != nil {
+		return "Unable to load this guild's config.", false
+	}
+
+	data, err := g.MarshalJSON()
+	if err != nil {
+		return "Unable to show this guild's config.", false
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return "Unable to show this guild's config.", false
+	}
+
+	source := "from the config file"
+	if edited {
+		source = "edited with this command"
+	}
+
+	/* Large configs are split over several messages */
+	header := fmt.Sprintf("This guild's config (%s):\n", source)
+	for _, block := range codeBlocks(header, indented.String()) {
+		ctx.ChannelSend(block)
+	}
+	return "", false
+}
+
+// set replaces the guild's config with the JSON given, which may be in a code
+// block.
+func (c Guild) set(
+	ctx *multiplexer.Context, g *config.GuildConfig,
+) (string, bool) {
+	raw := strings.TrimSpace(ctx.RawArguments)
+	raw = strings.TrimPrefix(strings.TrimSuffix(raw, "```"), "```")
+	raw = strings.TrimPrefix(raw, "json")
+
+	parsed, err := config.ParseGuild(raw)
+	if err != nil {
+		return "That config doesn't look right: " + err.Error(), false
+	}
+	for _, d := range parsed.DisabledCommands {
+		fields := strings.Fields(d)
+		if len(fields) > 0 && fields[0] == strings.ToLower(c.Command) {
+			return "This command can't be disabled.", false
+		}
+	}
+
+	*g = *parsed
+	return "Config updated.", true
+}
+
+// reset discards the edits made to the guild's config.
+func (c Guild) reset(
+	ctx *multiplexer.Context, g *config.GuildConfig,
+) (string, bool) {
+	if err := c.Reloader.ResetGuildConfig(ctx.Message.GuildID); err != nil {
+		return "Unable to reset this guild's config.", false
+	}
+	return "This guild's config has been reset to the one in the config file.", false
+}
+
+// prefix sets the guild's prefixes.
+func (c Guild) prefix(
+	ctx *multiplexer.Context, g *config.GuildConfig,
+) (string, bool) {
+	g.Prefixes = nil
+	for _, p := range ctx.Arguments {
+		if len(strings.TrimSpace(p)) != 0 {
+			g.Prefixes = append(g.Prefixes, p)
+		}
+	}
+	if len(g.Prefixes) == 0 {
+		return "This guild now uses the default prefixes.", true
+	}
+	return "This guild's prefixes are now: `" +
+		strings.Join(g.Prefixes, "` `") + "`", true
+}
+
+// simple adds or removes a simple command in the guild. The content is taken
+// from the raw arguments so its formatting is kept.
+func (c Guild) simple(
+	ctx *multiplexer.Context, g *config.GuildConfig,
+) (string, bool) {
+	name := strings.ToLower(ctx.String("name"))
+	if len(name) == 0 || strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+		return "Simple command names can't be empty or contain spaces.", false
+	}
+
+	content := ""
+	raw := strings.TrimSpace(ctx.RawArguments)
+	if i := strings.IndexFunc(raw, unicode.IsSpace); i >= 0 {
+		content = strings.TrimSpace(raw[i:])
+	}
+
+	if len(content) == 0 {
+		if _, ok := g.SimpleCommands[name]; !ok {
+			return fmt.Sprintf(
+				"This guild has no simple command called `%s`.", name,
+			), false
+		}
+		delete(g.SimpleCommands, name)
+		return fmt.Sprintf("Removed `%s`.", name), true
+	}
+
+	if _, _, _, ok := c.Reloader.Mux.Find(name); ok {
+		return fmt.Sprintf("There's already a command called `%s`.", name), false
+	}
+
+	g.SimpleCommands[name] = config.NewSimpleCommand(name, content)
+	return fmt.Sprintf("`%s%s` will now reply with that.", ctx.Prefix, name), true
+}
+
+// disable stops a command or simple command from being used in the guild.
+func (c Guild) disable(
+	ctx *multiplexer.Context, g *config.GuildConfig,
+) (string, bool) {
+	fields := strings.Fields(strings.ToLower(strings.Join(ctx.Arguments, " ")))
+	if len(fields) == 0 {
+		return "Which command should be disabled?", false
+	}
+	if fields[0] == strings.ToLower(c.Command) {
+		return "This command can't be disabled.", false
+	}
+	command := strings.Join(fields, " ")
+
+	command, ok := c.resolve(ctx.Message.GuildID, command)
+	if !ok {
+		return fmt.Sprintf("There's no command called `%s`.", command), false
+	}
+
+	for _, d := range g.DisabledCommands {
+		if d == command {
+			return fmt.Sprintf("`%s` is already disabled.", command), false
+		}
+	}
+
+	g.DisabledCommands = append(g.DisabledCommands, command)
+	sort.Strings(g.DisabledCommands)
+	return fmt.Sprintf("`%s` is now disabled in this guild.", command), true
+}
+
+// enable allows a disabled command to be used in the guild again.
+func (c Guild) enable(
+	ctx *multiplexer.Context, g *config.GuildConfig,
+) (string, bool) {
+	fields := strings.Fields(strings.ToLower(strings.Join(ctx.Arguments, " ")))
+	if len(fields) == 0 {
+		return "Which command should be enabled?", false
+	}
+
+	command := strings.Join(fields, " ")
+	if name, ok := c.resolve(ctx.Message.GuildID, command); ok {
+		command = name
+	}
+
+	for i, d := range g.DisabledCommands {
+		if d == command {
+			g.DisabledCommands = append(
+				g.DisabledCommands[:i], g.DisabledCommands[i+1:]...,
+			)
+			return fmt.Sprintf("`%s` is now enabled in this guild.", command), true
+		}
+	}
+
+	return fmt.Sprintf("`%s` isn't disabled.", command), false
+}
+
+// resolve looks up a command (by its full path) or simple command, including
+// simple commands which are currently disabled. Returns its name with any
+// aliases resolved, and whether or not it exists.
+func (c Guild) resolve(guildID, command string) (string, bool) {
+	mux := c.Reloader.Mux
+	if _, path, rest, ok := mux.Find(strings.Fields(command)...); ok {
+		return strings.Join(path, " "), len(rest) == 0
+	}
+
+	if s, ok := mux.FindSimple(command); ok {
+		return strings.ToLower(s.Command), true
+	}
+
+	if g := mux.Guild(guildID); g != nil {
+		for _, s := range g.SimpleCommands {
+			if strings.EqualFold(s.Command, command) {
+				return strings.ToLower(s.Command), true
+			}
+		}
+	}
+	return command, false
+}
+
+// codeBlocks splits text over as many code blocks as it takes to keep each
+// message within Discord's limit, breaking between lines where it can. The
+// header is put before the first block.
+func codeBlocks(header, text string) []string {
+	const open, close = "```json\n", "\n```"
+	limit := maxMessage - len(header) - len(open) - len(close)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		for len(line) > limit {
+			i := limit
+			for !utf8.RuneStart(line[i]) {
+				i--
+			}
+			lines = append(lines, line[:i])
+			line = line[i:]
+		}
+		lines = append(lines, line)
+	}
+
+	var blocks []string
+	chunk := ""
+	for i, line := range lines {
+		if i > 0 && len(chunk)+len(line)+1 > limit {
+			blocks = append(blocks, header+open+chunk+close)
+			header, chunk = "", ""
+		} else if i > 0 {
+			chunk += "\n"
+		}
+		chunk += line
+	}
+	return append(blocks, header+open+chunk+close)
+}
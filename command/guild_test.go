@@ -0,0 +1,38 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCodeBlocks(t *testing.T) {
+	tests := map[string]string{
+		"short":      `{"prefixes": ["?"]}`,
+		"many lines": strings.Repeat("  \"line\",\n", 500),
+		"long line":  strings.Repeat("é", 3000),
+	}
+
+	for name, text := range tests {
+		t.Run(name, func(t *testing.T) {
+			blocks := codeBlocks("Config:\n", text)
+			if !strings.HasPrefix(blocks[0], "Config:\n```json\n") {
+				t.Errorf("expected the header first, got %q", blocks[0][:20])
+			}
+
+			var joined []string
+			for _, b := range blocks {
+				if len(b) > maxMessage || !utf8.ValidString(b) {
+					t.Fatalf("expected blocks to be valid and within the limit, got %d bytes", len(b))
+				}
+				b = strings.TrimPrefix(b, "Config:\n")
+				joined = append(joined, b[len("```json\n"):len(b)-len("\n```")])
+			}
+
+			got := strings.Join(joined, "\n")
+			if strings.ReplaceAll(got, "\n", "") != strings.ReplaceAll(text, "\n", "") {
+				t.Error("expected the blocks to hold all of the text")
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
+)
+
+// Help lists the commands registered to the multiplexer, or shows the detailed
+// help of a single command when one is specified (e.g. `!help role add`).
+type Help struct {
+	Command  string
+	HelpText string
+	Aliases  []string
+
+	/* Number of commands shown per page. Defaults to 15 */
+	PageSize int
+
+	/* Category the simple commands from the config file are listed under.
+	   Defaults to "Other" */
+	SimpleCategory string
+
+	mux *multiplexer.Mux
+}
+
+// helpEntry is a single line of the command listing.
+type helpEntry struct {
+	category, command, helpText string
+}
+
+// Init is called by the multiplexer before the bot starts to initialize any
+// variables the command needs.
+func (c *Help) Init(m *multiplexer.Mux) {
+	c.mux = m
+
+	if c.PageSize <= 0 {
+		c.PageSize = 15
+	}
+
+	if len(c.SimpleCategory) == 0 {
+		c.SimpleCategory = "Other"
+	}
+}
+
+// Handle is called by the multiplexer whenever a user triggers the command.
+func (c *Help) Handle(ctx *multiplexer.Context) {
+	/* No arguments or a page number? List the commands */
+	if len(ctx.Arguments) == 0 {
+		c.list(ctx, 1)
+		return
+	}
+
+	if page, err := strconv.Atoi(ctx.Arguments[0]); err == nil {
+		c.list(ctx, page)
+		return
+	}
+
+	c.describe(ctx)
+}
+
+// HandleHelp explains how to use the help command itself.
+func (c *Help) HandleHelp(ctx *multiplexer.Context) {
+	ctx.ChannelSendf(
+		"Use `%s%s` to list every command you can use, `%s%s <page>` to see "+
+			"more of the list, or `%s%s <command>` to learn more about a command.",
+		ctx.Prefix, c.Command, ctx.Prefix, c.Command, ctx.Prefix, c.Command,
+	)
+}
+
+// Settings is called by the multiplexer on startup to process any settings
+// associated with that command.
+func (c *Help) Settings() *multiplexer.CommandSettings {
+	return &multiplexer.CommandSettings{
+		Command:  c.Command,
+		HelpText: c.HelpText,
+		Aliases:  c.Aliases,
+	}
+}
+
+// list sends the specified page of the command listing, hiding any commands
+// the user doesn't have permission to run.
+func (c *Help) list(ctx *multiplexer.Context, page int) {
+	var entries []helpEntry
+
+	for name, cmd := range c.mux.Commands() {
+		allowed, err := c.mux.CanRun(ctx, name)
+		if err != nil || !allowed {
+			continue
+		}
+
+		s := cmd.Settings()
+		category := s.Category
+		if len(category) == 0 {
+			category = "General"
+		}
+
+		entries = append(entries, helpEntry{category, name, s.HelpText})
+	}
+
+	for name, cmd := range c.mux.GuildSimpleCommands(ctx.Message.GuildID) {
+		entries = append(entries, helpEntry{c.SimpleCategory, name, cmd.HelpText})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].category != entries[j].category {
+			return entries[i].category < entries[j].category
+		}
+		return entries[i].command < entries[j].command
+	})
+
+	/* Work out which entries belong on the page */
+	pages := (len(entries) + c.PageSize - 1) / c.PageSize
+	if pages == 0 {
+		ctx.ChannelSend("There are no commands you can use.")
+		return
+	}
+
+	if page < 1 || page > pages {
+		ctx.ChannelSendf("There are only %d page(s) of commands.", pages)
+		return
+	}
+
+	start := (page - 1) * c.PageSize
+	end := start + c.PageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	var sb strings.Builder
+	category := ""
+	for _, e := range entries[start:end] {
+		if e.category != category {
+			category = e.category
+			sb.WriteString("**" + category + "**\n")
+		}
+
+		sb.WriteString(fmt.Sprintf("`%s%s`", ctx.Prefix, e.command))
+		if len(e.helpText) != 0 {
+			sb.WriteString(" - " + e.helpText)
+		}
+		sb.WriteString("\n")
+	}
+
+	if pages > 1 {
+		sb.WriteString(fmt.Sprintf(
+			"\nPage %d/%d. Use `%s%s <page>` to see more.",
+			page, pages, ctx.Prefix, c.Command,
+		))
+	}
+
+	ctx.ChannelSend(sb.String())
+}
+
+// describe sends the detailed help of the command named in the arguments by
+// delegating to its HandleHelp function.
+func (c *Help) describe(ctx *multiplexer.Context) {
+	simple, ok := c.mux.FindGuildSimple(ctx.Message.GuildID, ctx.Arguments[0])
+	if ok {
+		ctx.ChannelSendf("`%s%s` - %s", ctx.Prefix, simple.Command, simple.HelpText)
+		return
+	}
+
+	cmd, path, rest, ok := c.mux.Find(ctx.Arguments...)
+	if !ok {
+		ctx.ChannelSendf("There's no command called `%s`.", ctx.Arguments[0])
+		return
+	}
+
+	command := strings.Join(path, " ")
+	allowed, err := c.mux.CanRun(ctx, command)
+	if err != nil || !allowed {
+		ctx.ChannelSendf("There's no command called `%s`.", ctx.Arguments[0])
+		return
+	}
+
+	/* Hand the command a context which looks like it was called directly */
+	helpCtx := *ctx
+	helpCtx.Command = command
+	helpCtx.Arguments = rest
+
+	s := cmd.Settings()
+	if len(s.Arguments) > 0 {
+		prefix := ctx.Prefix
+		if len(path) > 1 {
+			prefix += strings.Join(path[:len(path)-1], " ") + " "
+		}
+		ctx.ChannelSendf("Usage: `%s`", s.Usage(prefix))
+	}
+
+	cmd.HandleHelp(&helpCtx)
+}
@@ -0,0 +1,52 @@
+package command
+
+import (
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/log"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/reload"
+)
+
+// Reload reloads the config file without restarting the bot. Only usable by
+// the bot's owners.
+type Reload struct {
+	Command  string
+	HelpText string
+
+	Reloader *reload.Reloader
+	Logger   *log.Logs
+}
+
+// Init is called by the multiplexer before the bot starts to initialize any
+// variables the command needs.
+func (c Reload) Init(m *multiplexer.Mux) {
+	// Nothing to init
+}
+
+// Handle is called by the multiplexer whenever a user triggers the command.
+func (c Reload) Handle(ctx *multiplexer.Context) {
+	if err := c.Reloader.Reload(); err != nil {
+		c.Logger.CmdErr(ctx, err, "Unable to reload the config, so the current one is still in use.")
+		return
+	}
+
+	ctx.ChannelSend("Config reloaded.")
+}
+
+// HandleHelp explains what the reload command does.
+func (c Reload) HandleHelp(ctx *multiplexer.Context) {
+	ctx.ChannelSend(
+		"Reloads the simple commands and permissions from the config file. " +
+			"If the new config can't be loaded, the current one is kept.",
+	)
+}
+
+// Settings is called by the multiplexer on startup to process any settings
+// associated with that command.
+func (c Reload) Settings() *multiplexer.CommandSettings {
+	return &multiplexer.CommandSettings{
+		Command:   c.Command,
+		HelpText:  c.HelpText,
+		Category:  "Admin",
+		OwnerOnly: true,
+	}
+}
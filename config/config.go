@@ -1,136 +1,477 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
-	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
 
 	"github.com/tidwall/gjson"
 )
 
-type (
-	// BotConfig defines the configuration container for the bot
-	BotConfig struct {
-		Path string
+// BotConfig defines the configuration container for the bot
+type BotConfig struct {
+	Path string
 
-		SimpleCommands map[string]string
-		Permissions    map[string]*multiplexer.CommandPermissions
+	/* The directory whose *.json files are merged into the config, and every
+	   file (or URL) the config was loaded from */
+	IncludeDir string
+	Sources    []string
+
+	Owners         []string
+	Prefixes       []string
+	SimpleCommands map[string]multiplexer.SimpleCommand
+	Permissions    map[string]*multiplexer.CommandPermissions
+	RateLimits     *multiplexer.RateLimits
+	Guilds         map[string]*GuildConfig
+
+	/* Problems found in the config which didn't stop it from loading */
+	Warnings []Problem
+
+	/* The merged document the config was read from */
+	json string
+}
+
+// GuildConfig overlays the global config in a single guild. Prefixes replace
+// the global ones, simple commands and permissions are added to (or replace)
+// the global ones, and DisabledCommands can't be used in the guild.
+type GuildConfig struct {
+	Prefixes         []string
+	SimpleCommands   map[string]multiplexer.SimpleCommand
+	Permissions      map[string]*multiplexer.CommandPermissions
+	DisabledCommands []string
+}
+
+// Get loads the config from the json file at the path specified, merging in
+// the files it includes and those in the config.d directory next to it (see
+// Load). The config is checked with Validate first, and a *ValidationError
+// listing every problem is returned if it isn't valid.
+func Get(path string) (*BotConfig, error) {
+	return Load(path, DefaultIncludeDir(path))
+}
+
+// Check loads the config at the path specified, along with the files it
+// includes and those in includeDir, and returns every problem found in them
+// (including conflicts between them).
+func Check(path, includeDir string) ([]Problem, error) {
+	_, l, err := load(path, includeDir)
+	return l.problems, err
+}
+
+func (c *BotConfig) Update() error {
+	new, err := Load(c.Path, c.IncludeDir)
+	if err != nil {
+		return err
 	}
 
-	// BotPermissions contains the permission maps for roles, channels, and
-	// users based on the config file.
-	BotPermissions struct {
-		RoleIDs map[string][]string
-		ChanIDs map[string][]string
-		UserIDs map[string][]string
+	c.Path = new.Path
+	c.IncludeDir = new.IncludeDir
+	c.Sources = new.Sources
+	c.Owners = new.Owners
+	c.Prefixes = new.Prefixes
+	c.SimpleCommands = new.SimpleCommands
+	c.Permissions = new.Permissions
+	c.RateLimits = new.RateLimits
+	c.Guilds = new.Guilds
+	c.Warnings = new.Warnings
+	c.json = new.json
+
+	return nil
+}
+
+// Equal checks if two configs were loaded from the same files, with the same
+// contents once merged.
+func (c *BotConfig) Equal(other *BotConfig) bool {
+	return other != nil && len(c.json) > 0 && c.json == other.json &&
+		c.IncludeDir == other.IncludeDir &&
+		strings.Join(c.Sources, "\n") == strings.Join(other.Sources, "\n")
+}
+
+// parse reads each section of a merged config which has already been
+// validated.
+func parse(json string) (*BotConfig, error) {
+	perms, err := getPermissions(json)
+	if err != nil {
+		return nil, err
 	}
-)
 
-// Get loads the config from the json file at the path specified
-func Get(path string) (*BotConfig, error) {
-	json, err := getJSON(path)
+	rateLimits, err := getRateLimits(json)
 	if err != nil {
-		return &BotConfig{}, err
+		return nil, err
 	}
 
-	simpleCommands, err := getSimpleCommands(json)
+	guilds, err := getGuilds(json)
 	if err != nil {
-		return &BotConfig{}, err
+		return nil, err
 	}
 
-	perms := getPermissions(json)
+	simple, err := getSimpleCommands(gjson.Get(json, "simpleCommands"))
+	if err != nil {
+		return nil, err
+	}
 
 	return &BotConfig{
-		Path:           path,
-		SimpleCommands: simpleCommands,
+		Owners:         getStrings(gjson.Get(json, "owners")),
+		Prefixes:       getStrings(gjson.Get(json, "prefixes")),
+		SimpleCommands: simple,
 		Permissions:    perms,
+		RateLimits:     rateLimits,
+		Guilds:         guilds,
 	}, nil
 }
 
-func (c *BotConfig) Update() error {
-	new, err := Get(c.Path)
+// ParseGuild reads the config of a single guild, in the same format as the
+// entries of "guilds" in the config file. A *ValidationError is returned if
+// it isn't valid. Since guild configs can be edited at runtime, the templates
+// of their simple commands can't use range or template actions.
+func ParseGuild(json string) (*GuildConfig, error) {
+	if !gjson.Valid(json) {
+		return nil, fmt.Errorf("guild config isn't valid JSON")
+	}
+
+	value := gjson.Parse(json)
+
+	var problems []Problem
+	guildSchema.validate("", value, &problems)
+	for _, p := range problems {
+		if !p.Warning {
+			return nil, &ValidationError{problems}
+		}
+	}
+
+	g, err := getGuild(value)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	c.Path = new.Path
-	c.SimpleCommands = new.SimpleCommands
-	c.Permissions = new.Permissions
+	names := make([]string, 0, len(g.SimpleCommands))
+	for name := range g.SimpleCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	return nil
+	for _, name := range names {
+		s := g.SimpleCommands[name]
+		if !s.Template {
+			continue
+		}
+
+		for _, text := range simpleTexts(s) {
+			if err := multiplexer.CheckUntrustedTemplate(text); err != nil {
+				return nil, fmt.Errorf("simple command %q: %w", name, err)
+			}
+		}
+	}
+	return g, nil
 }
 
-func getJSON(path string) (string, error) {
-	var json []byte
+// Copy returns a copy of the guild config which can be edited without
+// affecting the original. The permissions of each command (and the responses
+// and embeds of simple commands) are shared.
+func (g *GuildConfig) Copy() *GuildConfig {
+	out := &GuildConfig{
+		Prefixes:         append([]string(nil), g.Prefixes...),
+		SimpleCommands:   make(map[string]multiplexer.SimpleCommand),
+		Permissions:      make(map[string]*multiplexer.CommandPermissions),
+		DisabledCommands: append([]string(nil), g.DisabledCommands...),
+	}
 
-	if !util.IsURL(path) {
-		file, err := util.InitFile(path)
-		if err != nil {
-			return "", err
+	for k, v := range g.SimpleCommands {
+		out.SimpleCommands[k] = v
+	}
+	for k, v := range g.Permissions {
+		out.Permissions[k] = v
+	}
+	return out
+}
+
+// MarshalJSON writes the guild config in the same format it's read in.
+func (g *GuildConfig) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{})
+
+	if len(g.Prefixes) > 0 {
+		out["prefixes"] = g.Prefixes
+	}
+	if len(g.SimpleCommands) > 0 {
+		simple := make(map[string]interface{})
+		for name, s := range g.SimpleCommands {
+			simple[name] = simpleCommandJSON(s)
 		}
+		out["simpleCommands"] = simple
+	}
+	if len(g.DisabledCommands) > 0 {
+		out["disabledCommands"] = g.DisabledCommands
+	}
 
-		json, err = ioutil.ReadFile(file.Name())
-		if err != nil {
-			return "", err
+	if len(g.Permissions) > 0 {
+		perms := make(map[string]interface{})
+		for name, p := range g.Permissions {
+			perms[name] = permissionsJSON(p)
 		}
-	} else {
-		resp, err := http.Get(path)
+		out["permissions"] = perms
+	}
+
+	return json.Marshal(out)
+}
+
+// getGuilds reads the config of each guild under "guilds", keyed by guild ID.
+// Prefixes under the older "guildPrefixes" object are used for guilds which
+// don't set their own.
+func getGuilds(json string) (map[string]*GuildConfig, error) {
+	out := make(map[string]*GuildConfig)
+	var err error
+
+	gjson.Get(json, "guilds").ForEach(func(key, value gjson.Result) bool {
+		var g *GuildConfig
+		g, err = getGuild(value)
 		if err != nil {
-			return "", err
+			err = fmt.Errorf("guild %q: %w", key.String(), err)
+			return false
 		}
-		defer resp.Body.Close()
 
-		json, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return "", err
+		out[key.String()] = g
+		return true
+	})
+	if err != nil {
+		return out, err
+	}
+
+	gjson.Get(json, "guildPrefixes").ForEach(func(key, value gjson.Result) bool {
+		g, ok := out[key.String()]
+		if !ok {
+			g = &GuildConfig{}
+			out[key.String()] = g
+		}
+
+		if len(g.Prefixes) == 0 {
+			g.Prefixes = getStrings(value)
 		}
+		return true
+	})
+
+	return out, nil
+}
+
+// getGuild reads the config of a single guild.
+func getGuild(value gjson.Result) (*GuildConfig, error) {
+	if !value.IsObject() {
+		return nil, fmt.Errorf("guild config must be an object")
 	}
 
-	return string(json), nil
+	perms, err := parsePermissions(value.Get("permissions"))
+	if err != nil {
+		return nil, err
+	}
+
+	simple, err := getSimpleCommands(value.Get("simpleCommands"))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GuildConfig{
+		Prefixes:         getStrings(value.Get("prefixes")),
+		SimpleCommands:   simple,
+		Permissions:      perms,
+		DisabledCommands: getStrings(value.Get("disabledCommands")),
+	}
+
+	for i, name := range g.DisabledCommands {
+		g.DisabledCommands[i] = strings.ToLower(name)
+	}
+
+	return g, nil
 }
 
-func getSimpleCommands(json string) (map[string]string, error) {
-	out := make(map[string]string)
+// getStrings reads a value which is either a single string or an array of
+// strings. Numbers (such as IDs left unquoted in YAML) are read as they're
+// written.
+func getStrings(value gjson.Result) []string {
+	var out []string
 
-	m, ok := gjson.Parse(
-		gjson.Get(json, "simpleCommands").String(),
-	).Value().(map[string]interface{})
-	if !ok {
-		return out,
-			fmt.Errorf("unable to get list of simple commands from config file")
+	if !value.IsArray() {
+		if value.Type == gjson.String || value.Type == gjson.Number {
+			out = append(out, value.String())
+		}
+		return out
 	}
 
-	/* TODO: Better error handling in the event of a non-string value */
-	for k, v := range m {
-		out[k] = v.(string)
+	for _, v := range value.Array() {
+		out = append(out, v.String())
 	}
+	return out
+}
 
-	return out, nil
+// getPermissions reads the permissions of each command, keyed by command name
+// (or "*" for the default applied to commands without their own entry). Each
+// entry is either an object with "users", "roles" and "channels" arrays (plus
+// the same under "deny", and an optional "precedence" list of rules), or just
+// an array of role IDs.
+func getPermissions(
+	json string,
+) (map[string]*multiplexer.CommandPermissions, error) {
+	return parsePermissions(gjson.Get(json, "permissions"))
 }
 
-// TODO: Implement support for getting user ids and channel ids
-func getPermissions(json string) map[string]*multiplexer.CommandPermissions {
+// parsePermissions reads an object of permissions keyed by command name, in
+// the format described by getPermissions.
+func parsePermissions(
+	p gjson.Result,
+) (map[string]*multiplexer.CommandPermissions, error) {
 	out := make(map[string]*multiplexer.CommandPermissions)
+	var err error
 
-	p := gjson.Get(json, "permissions")
 	p.ForEach(func(key, value gjson.Result) bool {
-		var roles []string
+		perms := &multiplexer.CommandPermissions{}
 
 		if value.IsArray() {
-			for _, v := range value.Array() {
-				roles = append(roles, v.String())
+			perms.RoleIDs = getStrings(value)
+		} else {
+			perms.UserIDs = getStrings(value.Get("users"))
+			perms.RoleIDs = getStrings(value.Get("roles"))
+			perms.ChanIDs = getStrings(value.Get("channels"))
+
+			perms.DenyUserIDs = getStrings(value.Get("deny.users"))
+			perms.DenyRoleIDs = getStrings(value.Get("deny.roles"))
+			perms.DenyChanIDs = getStrings(value.Get("deny.channels"))
+
+			for _, name := range getStrings(value.Get("precedence")) {
+				var rule multiplexer.Rule
+				rule, err = multiplexer.ParseRule(name)
+				if err != nil {
+					err = fmt.Errorf("permissions for %q: %w", key.String(), err)
+					return false
+				}
+				perms.Precedence = append(perms.Precedence, rule)
 			}
 		}
 
-		out[strings.ToLower(key.String())] = &multiplexer.CommandPermissions{
-			RoleIDs: roles,
-		}
+		out[strings.ToLower(key.String())] = perms
 
 		return true
 	})
+	return out, err
+}
+
+// getRateLimits reads the "global" rate limit, and the rate limits of each
+// command under "commands" and each guild under "guilds".
+func getRateLimits(json string) (*multiplexer.RateLimits, error) {
+	out := &multiplexer.RateLimits{
+		Commands: make(map[string]multiplexer.LimitSpec),
+		Guilds:   make(map[string]multiplexer.LimitSpec),
+	}
+
+	r := gjson.Get(json, "rateLimits")
+
+	if global := r.Get("global"); global.Exists() {
+		spec, err := getLimitSpec(global)
+		if err != nil {
+			return out, fmt.Errorf("global rate limit: %w", err)
+		}
+		out.Global = &spec
+	}
+
+	var err error
+	for _, section := range []struct {
+		key, name string
+		specs     map[string]multiplexer.LimitSpec
+	}{
+		{"commands", "command", out.Commands},
+		{"guilds", "guild", out.Guilds},
+	} {
+		r.Get(section.key).ForEach(func(key, value gjson.Result) bool {
+			var spec multiplexer.LimitSpec
+			spec, err = getLimitSpec(value)
+			if err != nil {
+				err = fmt.Errorf(
+					"rate limit for %s %q: %w", section.name, key.String(), err,
+				)
+				return false
+			}
+
+			section.specs[strings.ToLower(key.String())] = spec
+			return true
+		})
+		if err != nil {
+			return out, err
+		}
+	}
+
+	return out, nil
+}
+
+// getLimitSpec reads a single rate limit, e.g. {"limit": 5, "window": "1m"}.
+// The type defaults to "sliding-window" and the scope to "user".
+func getLimitSpec(value gjson.Result) (multiplexer.LimitSpec, error) {
+	spec := multiplexer.LimitSpec{
+		Type:  multiplexer.LimitSlidingWindow,
+		Limit: int(value.Get("limit").Int()),
+		Scope: multiplexer.ScopeUser,
+	}
+
+	if spec.Limit <= 0 {
+		return spec, fmt.Errorf("limit must be above 0")
+	}
+
+	window, err := time.ParseDuration(value.Get("window").String())
+	if err != nil {
+		return spec, fmt.Errorf("invalid window: %w", err)
+	}
+	if window <= 0 {
+		return spec, fmt.Errorf("window must be above 0")
+	}
+	spec.Window = window
+
+	if t := value.Get("type"); t.Exists() {
+		if spec.Type, err = multiplexer.ParseLimitType(t.String()); err != nil {
+			return spec, err
+		}
+	}
+
+	if s := value.Get("scope"); s.Exists() {
+		if spec.Scope, err = multiplexer.ParseLimitScope(s.String()); err != nil {
+			return spec, err
+		}
+	}
+
+	return spec, nil
+}
+
+// permissionsJSON converts permissions back into the format they're read in.
+func permissionsJSON(p *multiplexer.CommandPermissions) map[string]interface{} {
+	out := make(map[string]interface{})
+	deny := make(map[string]interface{})
+
+	for _, list := range []struct {
+		into  map[string]interface{}
+		key   string
+		value []string
+	}{
+		{out, "users", p.UserIDs},
+		{out, "roles", p.RoleIDs},
+		{out, "channels", p.ChanIDs},
+		{deny, "users", p.DenyUserIDs},
+		{deny, "roles", p.DenyRoleIDs},
+		{deny, "channels", p.DenyChanIDs},
+	} {
+		if len(list.value) > 0 {
+			list.into[list.key] = list.value
+		}
+	}
+
+	if len(deny) > 0 {
+		out["deny"] = deny
+	}
+
+	if len(p.Precedence) > 0 {
+		var precedence []string
+		for _, r := range p.Precedence {
+			precedence = append(precedence, r.String())
+		}
+		out["precedence"] = precedence
+	}
+
 	return out
 }
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGuild(t *testing.T) {
+	tests := []struct {
+		name, json, problem string
+	}{
+		{
+			name: "valid",
+			json: `{"prefixes": ["?"], "disabledCommands": "Example"}`,
+		},
+		{
+			name:    "empty prefix",
+			json:    `{"prefixes": [""]}`,
+			problem: "prefixes[0]: can't be empty",
+		},
+		{
+			name:    "blank prefix",
+			json:    `{"prefixes": "  "}`,
+			problem: "prefixes: can't be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseGuild(tt.json)
+			if len(tt.problem) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if g.DisabledCommands[0] != "example" {
+					t.Errorf("expected disabled commands to be lower case, got %q", g.DisabledCommands)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("expected %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
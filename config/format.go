@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+/* Formats a config file can be written in */
+const (
+	formatJSON = "JSON"
+	formatYAML = "YAML"
+	formatTOML = "TOML"
+)
+
+/* Extensions of each format, which are the files merged from include dirs */
+var formatExts = map[string]string{
+	".json": formatJSON,
+	".yaml": formatYAML,
+	".yml":  formatYAML,
+	".toml": formatTOML,
+}
+
+// IncludeFiles returns the config files (*.json, *.yaml, *.yml and *.toml) in
+// an include directory, in name order.
+func IncludeFiles(dir string) ([]string, error) {
+	var files []string
+	for ext := range formatExts {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+/* === Helper Functions === */
+
+// detectFormat works out the format of a config from its extension or, for
+// URLs without a known extension, the Content-Type it was served with.
+// Anything else is read as JSON.
+func detectFormat(source, contentType string) string {
+	name := source
+	if util.IsURL(source) {
+		if u, err := url.Parse(source); err == nil {
+			name = u.Path
+		}
+	}
+
+	if format, ok := formatExts[strings.ToLower(path.Ext(name))]; ok {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return formatYAML
+	case "application/toml", "text/toml", "text/x-toml":
+		return formatTOML
+	}
+	return formatJSON
+}
+
+// toJSON converts a YAML or TOML config into JSON, which the config is read
+// as from then on. JSON configs are returned as they are.
+func toJSON(data, format string) (string, error) {
+	var doc interface{}
+
+	switch format {
+	case formatYAML:
+		if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+			return "", err
+		}
+	case formatTOML:
+		var table map[string]interface{}
+		if _, err := toml.Decode(data, &table); err != nil {
+			return "", err
+		}
+		doc = table
+	default:
+		return data, nil
+	}
+
+	out, err := json.Marshal(jsonValue(doc))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// jsonValue converts the maps YAML decodes with non-string keys (e.g. "1: x")
+// into ones encoding/json can write.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = jsonValue(item)
+		}
+		return v
+
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[fmt.Sprint(k)] = jsonValue(item)
+		}
+		return out
+
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+
+	default:
+		return v
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a file into dir, returning its path.
+func writeFile(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		name, file, data string
+	}{
+		{
+			name: "json",
+			file: "config.json",
+			data: `{
+				"owners": [123456789012345678, "876543210987654321"],
+				"simpleCommands": {"rules": "1. Be nice\n2. No spam\n"},
+				"permissions": {
+					"ping": {"roles": 111111111111111111, "deny": {"users": [222222222222222222]}}
+				}
+			}`,
+		},
+		{
+			name: "yaml",
+			file: "config.yaml",
+			data: `
+owners: [123456789012345678, "876543210987654321"]
+simpleCommands:
+  rules: |
+    1. Be nice
+    2. No spam
+permissions:
+  ping:
+    roles: 111111111111111111
+    deny:
+      users: [222222222222222222]
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			data: `
+owners = [123456789012345678, "876543210987654321"]
+
+[simpleCommands]
+rules = """
+1. Be nice
+2. No spam
+"""
+
+[permissions.ping]
+roles = 111111111111111111
+
+[permissions.ping.deny]
+users = [222222222222222222]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), tt.file, tt.data)
+
+			cfg, err := Load(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			owners := []string{"123456789012345678", "876543210987654321"}
+			if !reflect.DeepEqual(cfg.Owners, owners) {
+				t.Errorf("expected owners %v, got %v", owners, cfg.Owners)
+			}
+
+			if rules := cfg.SimpleCommands["rules"].Content; rules != "1. Be nice\n2. No spam\n" {
+				t.Errorf("unexpected rules %q", rules)
+			}
+
+			ping := cfg.Permissions["ping"]
+			if ping == nil ||
+				!reflect.DeepEqual(ping.RoleIDs, []string{"111111111111111111"}) ||
+				!reflect.DeepEqual(ping.DenyUserIDs, []string{"222222222222222222"}) {
+				t.Errorf("unexpected permissions %+v", ping)
+			}
+		})
+	}
+}
+
+func TestFormatProblems(t *testing.T) {
+	tests := []struct {
+		file, data, problem string
+	}{
+		{"bad.yaml", "owners: [\n", "invalid YAML"},
+		{"bad.toml", "owners = [", "invalid TOML"},
+		{"ids.yaml", "owners: [1.5]", "owners[0]: must be a whole number"},
+		{"ids.toml", "owners = [-1]", "owners[0]: must be a whole number"},
+		{"prefixes.yaml", "prefixes: [1]", "prefixes[0]: must be a string"},
+		{"blank.yaml", "prefixes: [\"!\", \" \"]", "prefixes[1]: can't be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), tt.file, tt.data)
+
+			_, err := Load(path, "")
+			if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("expected %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestRemoteFormat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+			w.Write([]byte("owners: [123456789012345678]\n"))
+		},
+	))
+	defer srv.Close()
+
+	cfg, err := Load(srv.URL+"/config", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Owners, []string{"123456789012345678"}) {
+		t.Errorf("unexpected owners %v", cfg.Owners)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		source, contentType, format string
+	}{
+		{"config.json", "", formatJSON},
+		{"config.YML", "", formatYAML},
+		{"config.toml", "application/json", formatTOML},
+		{"https://example.com/config.yaml?v=2", "", formatYAML},
+		{"https://example.com/config", "text/yaml", formatYAML},
+		{"https://example.com/config", "application/toml", formatTOML},
+		{"https://example.com/config", "text/plain", formatJSON},
+	}
+
+	for _, tt := range tests {
+		if f := detectFormat(tt.source, tt.contentType); f != tt.format {
+			t.Errorf("%s (%s): expected %s, got %s",
+				tt.source, tt.contentType, tt.format, f)
+		}
+	}
+}
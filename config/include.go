@@ -0,0 +1,350 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
+
+	"github.com/tidwall/gjson"
+)
+
+// IncludeDirName is the name of the directory next to a local config file
+// whose config files (see IncludeFiles) are merged into it by Get.
+const IncludeDirName = "config.d"
+
+// loader reads a config along with every file it includes, merging them into
+// a single document. Objects are merged key by key, and any other value set
+// differently by two files is reported as a conflict.
+type loader struct {
+	merged   map[string]interface{}
+	owners   map[string]string
+	sources  []string
+	loaded   map[string]bool
+	problems []Problem
+
+	/* Remote configs to cache if the config loads successfully */
+	remote []*remoteConfig
+}
+
+// Load loads the config from the file (or URL) at the path specified, along
+// with any files it includes and the config files in includeDir (in name
+// order). An empty includeDir merges nothing in. Files may be JSON, YAML or
+// TOML, detected by their extension or the Content-Type of URLs. Every file
+// is checked with Validate, and a *ValidationError is returned if any aren't
+// valid or if two of them set the same key to different values.
+func Load(path, includeDir string) (*BotConfig, error) {
+	json, l, err := load(path, includeDir)
+	if err != nil {
+		return &BotConfig{}, err
+	}
+
+	var warnings []Problem
+	for _, p := range l.problems {
+		if !p.Warning {
+			return &BotConfig{}, &ValidationError{l.problems}
+		}
+		warnings = append(warnings, p)
+	}
+
+	cfg, err := parse(json)
+	if err != nil {
+		return &BotConfig{}, err
+	}
+
+	for _, c := range l.remote {
+		if err := saveRemote(c); err != nil {
+			warnings = append(warnings, Problem{
+				File:    c.URL,
+				Message: "unable to cache: " + err.Error(),
+				Warning: true,
+			})
+		}
+	}
+
+	cfg.Path = path
+	cfg.IncludeDir = includeDir
+	cfg.Sources = l.sources
+	cfg.Warnings = warnings
+	cfg.json = json
+	return cfg, nil
+}
+
+// DefaultIncludeDir returns the directory merged into the config at the path
+// specified by Get: the config.d directory next to it for local files, or
+// nothing for URLs.
+func DefaultIncludeDir(path string) string {
+	if util.IsURL(path) {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), IncludeDirName)
+}
+
+/* === Helper Functions === */
+
+// load reads and merges the config at path, its includes and the files in
+// includeDir, returning the merged document.
+func load(path, includeDir string) (string, *loader, error) {
+	l := &loader{
+		merged: make(map[string]interface{}),
+		owners: make(map[string]string),
+		loaded: make(map[string]bool),
+	}
+
+	if err := l.add(path); err != nil {
+		return "", l, err
+	}
+
+	if len(includeDir) > 0 {
+		files, err := IncludeFiles(includeDir)
+		if err != nil {
+			return "", l, err
+		}
+
+		for _, file := range files {
+			if err := l.add(file); err != nil {
+				return "", l, err
+			}
+		}
+	}
+
+	out, err := json.Marshal(l.merged)
+	if err != nil {
+		return "", l, err
+	}
+	return string(out), l, nil
+}
+
+// add reads a single file, resolves its references, validates it and merges
+// it in, followed by the files it includes. Files which have already been
+// merged are skipped, so files can safely include each other.
+func (l *loader) add(source string) error {
+	if l.loaded[source] {
+		return nil
+	}
+	l.loaded[source] = true
+	l.sources = append(l.sources, source)
+
+	data, contentType, err := l.read(source)
+	if err != nil {
+		return err
+	}
+
+	/* YAML and TOML configs are read as JSON from here on */
+	format := detectFormat(source, contentType)
+	if data, err = toJSON(data, format); err != nil {
+		l.problems = append(l.problems, Problem{
+			File: source, Message: fmt.Sprintf("invalid %s: %s", format, err),
+		})
+		return nil
+	}
+
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(data)))
+	dec.UseNumber()
+	if !gjson.Valid(data) || dec.Decode(&doc) != nil || doc == nil {
+		/* Not an object, which Validate reports */
+		l.validate(source, data)
+		return nil
+	}
+
+	/* References in remote configs could leak secrets unless they're signed */
+	trusted := !util.IsURL(source) || remoteOptions().PublicKey != nil
+	l.interpolate(doc, "", source, trusted)
+
+	resolved, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	l.validate(source, string(resolved))
+
+	includes := getStrings(gjson.GetBytes(resolved, "include"))
+	delete(doc, "include")
+
+	l.merge(l.merged, doc, "", source)
+
+	for _, include := range includes {
+		files, err := resolveInclude(source, include)
+		if err != nil {
+			l.problems = append(l.problems, Problem{
+				File: source, Path: "include", Message: err.Error(),
+			})
+			continue
+		}
+
+		for _, file := range files {
+			if err := l.add(file); err != nil {
+				return fmt.Errorf("%s: include %q: %w", source, include, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks a single file, adding the problems found in it.
+func (l *loader) validate(source, json string) {
+	for _, p := range Validate(json) {
+		p.File = source
+		l.problems = append(l.problems, p)
+	}
+}
+
+// merge copies the keys of src into dst, merging objects and reporting any
+// other values which are already set to something else. Empty arrays and
+// objects count as unset, so they never conflict with another file's values.
+func (l *loader) merge(dst, src map[string]interface{}, path, source string) {
+	/* Sort the keys so conflicts are always reported in the same order */
+	keys := make([]string, 0, len(src))
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := src[k]
+		child := joinPath(path, k)
+
+		existing, ok := dst[k]
+		if !ok || (isEmpty(existing) && !isEmpty(v)) {
+			dst[k] = v
+			l.owners[child] = source
+			continue
+		}
+		if isEmpty(v) {
+			continue
+		}
+
+		dstObj, dstOK := existing.(map[string]interface{})
+		srcObj, srcOK := v.(map[string]interface{})
+		if dstOK && srcOK {
+			l.merge(dstObj, srcObj, child, source)
+			continue
+		}
+
+		if !reflect.DeepEqual(existing, v) {
+			l.problems = append(l.problems, Problem{
+				File:    source,
+				Path:    child,
+				Message: "conflicts with the value set in " + l.owner(child),
+			})
+		}
+	}
+}
+
+// isEmpty checks if a value is an empty array or object.
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// owner returns the file which set the value at the path (or the object it's
+// in).
+func (l *loader) owner(path string) string {
+	for p := path; len(p) > 0; p = parentPath(p) {
+		if source, ok := l.owners[p]; ok {
+			return source
+		}
+	}
+	return "another file"
+}
+
+// resolveInclude finds the files an include refers to. Includes are relative
+// to the file they're in, and may use globs (e.g. "permissions/*.json") in
+// local files.
+func resolveInclude(source, include string) ([]string, error) {
+	if util.IsURL(include) {
+		return []string{include}, nil
+	}
+
+	if util.IsURL(source) {
+		base, err := url.Parse(source)
+		if err != nil {
+			return nil, err
+		}
+		ref, err := url.Parse(include)
+		if err != nil {
+			return nil, err
+		}
+		return []string{base.ResolveReference(ref).String()}, nil
+	}
+
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(filepath.Dir(source), include)
+	}
+
+	if !strings.ContainsAny(include, "*?[") {
+		return []string{include}, nil
+	}
+
+	files, err := filepath.Glob(include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", include, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// read reads a local file or fetches a URL, along with the Content-Type of
+// URLs. If a URL can't be reached, the last good copy of it is used instead
+// (with a warning) if there is one.
+func (l *loader) read(source string) (string, string, error) {
+	if util.IsURL(source) {
+		c, err := fetchRemote(source)
+		if c == nil {
+			return "", "", err
+		}
+
+		/* Signed configs are checked every time, since the key may change */
+		if key := remoteOptions().PublicKey; key != nil {
+			if verr := Verify([]byte(c.Body), c.Signature, key); verr != nil {
+				return "", "", fmt.Errorf("%s: %w", source, verr)
+			}
+		}
+
+		if err != nil {
+			l.problems = append(l.problems, Problem{
+				File: source,
+				Message: fmt.Sprintf(
+					"unable to fetch (%s), using the copy from %s",
+					err, c.Fetched.Format(time.RFC3339),
+				),
+				Warning: true,
+			})
+		}
+
+		l.remote = append(l.remote, c)
+		return c.Body, c.ContentType, nil
+	}
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), "", nil
+}
+
+// parentPath removes the last key from a path built by joinPath.
+func parentPath(path string) string {
+	if strings.HasSuffix(path, "\"]") {
+		if i := strings.LastIndex(path, "[\""); i >= 0 {
+			return path[:i]
+		}
+	}
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
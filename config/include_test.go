@@ -0,0 +1,180 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadIncludes(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+
+		owners, prefixes, simple []string
+		sources                  []string
+		problems                 []string
+	}{
+		{
+			name: "separate keys",
+			files: map[string]string{
+				"config.json": `{"owners": ["1"], "include": "more.json"}`,
+				"more.json":   `{"prefixes": ["?"]}`,
+			},
+			owners: []string{"1"}, prefixes: []string{"?"},
+		},
+		{
+			name: "objects are merged key by key",
+			files: map[string]string{
+				"config.json": `{"simpleCommands": {"a": "x"}, "include": "more.json"}`,
+				"more.json":   `{"simpleCommands": {"b": "y"}}`,
+			},
+			simple: []string{"a", "b"},
+		},
+		{
+			name: "the same value twice",
+			files: map[string]string{
+				"config.json": `{"prefixes": ["!"], "include": "more.json"}`,
+				"more.json":   `{"prefixes": ["!"]}`,
+			},
+			prefixes: []string{"!"},
+		},
+		{
+			name: "empty array is overridden",
+			files: map[string]string{
+				"config.json": `{"prefixes": [], "include": "more.json"}`,
+				"more.json":   `{"prefixes": ["?"]}`,
+			},
+			prefixes: []string{"?"},
+		},
+		{
+			name: "empty array doesn't override",
+			files: map[string]string{
+				"config.json": `{"prefixes": ["!"], "include": "more.json"}`,
+				"more.json":   `{"prefixes": []}`,
+			},
+			prefixes: []string{"!"},
+		},
+		{
+			name: "empty object is overridden",
+			files: map[string]string{
+				"config.json": `{"simpleCommands": {}, "include": "more.json"}`,
+				"more.json":   `{"simpleCommands": {"a": "x"}}`,
+			},
+			simple: []string{"a"},
+		},
+		{
+			name: "conflict",
+			files: map[string]string{
+				"config.json": `{"prefixes": ["!"], "include": "more.json"}`,
+				"more.json":   `{"prefixes": ["?"]}`,
+			},
+			problems: []string{
+				"more.json: prefixes: conflicts with the value set in ",
+				"config.json",
+			},
+		},
+		{
+			name: "nested conflict",
+			files: map[string]string{
+				"config.json": `{"simpleCommands": {"a": "x"}, "include": "more.json"}`,
+				"more.json":   `{"simpleCommands": {"a": "y"}}`,
+			},
+			problems: []string{
+				"more.json: simpleCommands.a: conflicts with the value set in ",
+				"config.json",
+			},
+		},
+		{
+			name: "conflict between include dir files",
+			files: map[string]string{
+				"config.json":     `{}`,
+				"config.d/a.json": `{"owners": ["1"]}`,
+				"config.d/b.yaml": `owners: ["2"]`,
+			},
+			problems: []string{
+				"b.yaml: owners: conflicts with the value set in ",
+				filepath.Join("config.d", "a.json"),
+			},
+		},
+		{
+			name: "include order",
+			files: map[string]string{
+				"config.json":     `{"include": ["b.json", "a.json", "parts/*.json"]}`,
+				"b.json":          `{"include": "c.json"}`,
+				"c.json":          `{}`,
+				"a.json":          `{"include": "config.json"}`,
+				"parts/2.json":    `{}`,
+				"parts/1.json":    `{}`,
+				"config.d/1.yaml": `{}`,
+				"config.d/0.json": `{}`,
+			},
+			sources: []string{
+				"config.json", "b.json", "c.json", "a.json",
+				filepath.Join("parts", "1.json"), filepath.Join("parts", "2.json"),
+				filepath.Join("config.d", "0.json"),
+				filepath.Join("config.d", "1.yaml"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, filepath.Dir(path), filepath.Base(path), data)
+			}
+
+			cfg, err := Load(
+				filepath.Join(dir, "config.json"), filepath.Join(dir, "config.d"),
+			)
+			if len(tt.problems) > 0 {
+				if err == nil {
+					t.Fatalf("expected a problem, got none")
+				}
+				for _, p := range tt.problems {
+					if !strings.Contains(err.Error(), p) {
+						t.Errorf("expected %q in %q", p, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var simple []string
+			for name := range cfg.SimpleCommands {
+				simple = append(simple, name)
+			}
+			sort.Strings(simple)
+
+			var sources []string
+			for _, s := range cfg.Sources {
+				rel, _ := filepath.Rel(dir, s)
+				sources = append(sources, rel)
+			}
+
+			for _, c := range []struct {
+				name          string
+				got, expected []string
+			}{
+				{"owners", cfg.Owners, tt.owners},
+				{"prefixes", cfg.Prefixes, tt.prefixes},
+				{"simple commands", simple, tt.simple},
+				{"sources", sources, tt.sources},
+			} {
+				if c.expected != nil && !reflect.DeepEqual(c.got, c.expected) {
+					t.Errorf("expected %s %q, got %q", c.name, c.expected, c.got)
+				}
+			}
+		})
+	}
+}
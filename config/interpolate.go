@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/* Matches ${VAR}, ${file:/path} and the $${ escape */
+var reference = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+/* === Helper Functions === */
+
+// interpolate replaces references in the string values of a config (as
+// decoded by encoding/json) with environment variables (${VAR}) or the
+// contents of files (${file:/run/secrets/x}). "$${" is replaced with "${", so
+// "$${VAR}" is left as "${VAR}", but any other "$" is left alone. References
+// which can't be resolved are reported as problems, as are any references at
+// all in untrusted files.
+func (l *loader) interpolate(
+	v interface{}, path, source string, trusted bool,
+) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v[k] = l.interpolate(v[k], joinPath(path, k), source, trusted)
+		}
+		return v
+
+	case []interface{}:
+		for i := range v {
+			item := fmt.Sprintf("%s[%d]", path, i)
+			v[i] = l.interpolate(v[i], item, source, trusted)
+		}
+		return v
+
+	case string:
+		return l.resolve(v, path, source, trusted)
+
+	default:
+		return v
+	}
+}
+
+// resolve replaces the references in a single string.
+func (l *loader) resolve(s, path, source string, trusted bool) string {
+	return reference.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+
+		problem := Problem{File: source, Path: path}
+		if !trusted {
+			problem.Message = fmt.Sprintf(
+				"%s can't be used, references are only resolved in local "+
+					"or signed configs", match,
+			)
+			l.problems = append(l.problems, problem)
+			return match
+		}
+
+		value, err := resolveReference(match[2 : len(match)-1])
+		if err != nil {
+			problem.Message = fmt.Sprintf("unresolved reference %s: %s", match, err)
+			l.problems = append(l.problems, problem)
+			return match
+		}
+		return value
+	})
+}
+
+// resolveReference looks up the value of a reference, without the ${}.
+func resolveReference(ref string) (string, error) {
+	if strings.HasPrefix(ref, "file:") {
+		path := strings.TrimPrefix(ref, "file:")
+		if len(path) == 0 {
+			return "", fmt.Errorf("no file given")
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		/* Secrets are usually written with a trailing newline */
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if len(ref) == 0 {
+		return "", fmt.Errorf("no variable name given")
+	}
+
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s isn't set", ref)
+	}
+	return value, nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("BUILD_A_BOT_TEST", "secret")
+	t.Cleanup(func() { os.Unsetenv("BUILD_A_BOT_TEST") })
+	os.Unsetenv("BUILD_A_BOT_MISSING")
+
+	dir := t.TempDir()
+	file := writeFile(t, dir, "token", "from a file\n")
+
+	tests := []struct {
+		name, value, expected, problem string
+		untrusted                      bool
+	}{
+		{
+			name:     "variable",
+			value:    "token ${BUILD_A_BOT_TEST}!",
+			expected: "token secret!",
+		},
+		{
+			name:     "file",
+			value:    "${file:" + file + "}",
+			expected: "from a file",
+		},
+		{
+			name:     "several references",
+			value:    "${BUILD_A_BOT_TEST}/${BUILD_A_BOT_TEST}",
+			expected: "secret/secret",
+		},
+		{
+			name:     "no references",
+			value:    "costs $5, or $$10 {honestly}",
+			expected: "costs $5, or $$10 {honestly}",
+		},
+		{
+			name:     "escaped reference",
+			value:    "$${BUILD_A_BOT_TEST} is ${BUILD_A_BOT_TEST}",
+			expected: "${BUILD_A_BOT_TEST} is secret",
+		},
+		{
+			name:     "missing variable",
+			value:    "${BUILD_A_BOT_MISSING}",
+			expected: "${BUILD_A_BOT_MISSING}",
+			problem:  "environment variable BUILD_A_BOT_MISSING isn't set",
+		},
+		{
+			name:     "missing file",
+			value:    "${file:" + filepath.Join(dir, "missing") + "}",
+			expected: "${file:" + filepath.Join(dir, "missing") + "}",
+			problem:  "unresolved reference ${file:",
+		},
+		{
+			name:     "empty reference",
+			value:    "${}",
+			expected: "${}",
+			problem:  "no variable name given",
+		},
+		{
+			name:      "untrusted",
+			value:     "${BUILD_A_BOT_TEST}",
+			expected:  "${BUILD_A_BOT_TEST}",
+			problem:   "only resolved in local or signed configs",
+			untrusted: true,
+		},
+		{
+			name:      "untrusted escape",
+			value:     "$${BUILD_A_BOT_TEST}",
+			expected:  "${BUILD_A_BOT_TEST}",
+			untrusted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &loader{}
+			doc := map[string]interface{}{
+				"simpleCommands": map[string]interface{}{
+					"test": []interface{}{tt.value},
+				},
+			}
+			l.interpolate(doc, "", "config.json", !tt.untrusted)
+
+			got := doc["simpleCommands"].(map[string]interface{})["test"].([]interface{})[0]
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+
+			if len(tt.problem) == 0 {
+				if len(l.problems) > 0 {
+					t.Errorf("unexpected problems %v", l.problems)
+				}
+				return
+			}
+			if len(l.problems) != 1 {
+				t.Fatalf("expected a problem, got %v", l.problems)
+			}
+			p := l.problems[0]
+			if p.Path != "simpleCommands.test[0]" ||
+				!strings.Contains(p.Message, tt.problem) {
+				t.Errorf("expected %q at simpleCommands.test[0], got %s", tt.problem, p)
+			}
+		})
+	}
+}
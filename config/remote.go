@@ -0,0 +1,220 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RemoteOptions controls how configs are fetched from URLs. Failed requests
+// are retried Retries times, waiting Backoff before the first retry and twice
+// as long before each one after. If CacheDir is set, the last good copy of
+// each remote config is saved there and used when its URL can't be reached.
+// If PublicKey is set, remote configs must have a detached signature made with
+// the matching private key (see SignatureHeader), or they won't be loaded.
+type RemoteOptions struct {
+	Timeout   time.Duration
+	Retries   int
+	Backoff   time.Duration
+	CacheDir  string
+	PublicKey ed25519.PublicKey
+}
+
+// remoteConfig is a copy of a remote config, along with what's needed to ask
+// the server if it's changed.
+type remoteConfig struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	ContentType  string    `json:"contentType,omitempty"`
+	Body         string    `json:"body"`
+	Signature    string    `json:"signature,omitempty"`
+}
+
+var (
+	remoteLock sync.Mutex
+	remote     = RemoteOptions{
+		Timeout: 10 * time.Second,
+		Retries: 2,
+		Backoff: time.Second,
+	}
+
+	/* The last good copy of each remote config, keyed by URL */
+	remoteCache = make(map[string]*remoteConfig)
+)
+
+// SetRemoteOptions changes how configs are fetched from URLs.
+func SetRemoteOptions(o RemoteOptions) {
+	remoteLock.Lock()
+	defer remoteLock.Unlock()
+
+	remote = o
+}
+
+/* === Helper Functions === */
+
+// remoteOptions returns the options remote configs are fetched with.
+func remoteOptions() RemoteOptions {
+	remoteLock.Lock()
+	defer remoteLock.Unlock()
+
+	return remote
+}
+
+// fetchRemote fetches a config from a URL, only downloading it again if it has
+// changed since the last good copy. If it can't be fetched but there's a good
+// copy, that's returned along with the error which stopped it being fetched.
+func fetchRemote(url string) (*remoteConfig, error) {
+	opts := remoteOptions()
+
+	last := cachedRemote(url, opts.CacheDir)
+	client := &http.Client{Timeout: opts.Timeout}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var (
+			c     *remoteConfig
+			retry bool
+		)
+		c, retry, err = fetchOnce(client, url, last, opts.PublicKey != nil)
+		if err == nil {
+			return c, nil
+		}
+
+		if !retry || attempt >= opts.Retries {
+			break
+		}
+		time.Sleep(opts.Backoff << uint(attempt))
+	}
+
+	return last, err
+}
+
+// fetchOnce makes a single request for a remote config (and its signature, if
+// signed is set), returning whether it's worth trying again if it fails.
+func fetchOnce(
+	client *http.Client, url string, last *remoteConfig, signed bool,
+) (*remoteConfig, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	/* Copies saved before signing was turned on have to be fetched again */
+	if last != nil && (!signed || len(last.Signature) > 0) {
+		if len(last.ETag) > 0 {
+			req.Header.Set("If-None-Match", last.ETag)
+		}
+		if len(last.LastModified) > 0 {
+			req.Header.Set("If-Modified-Since", last.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && last != nil {
+		return last, false, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		/* Only server errors and rate limits are likely to go away */
+		retry := resp.StatusCode >= 500 ||
+			resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	c := &remoteConfig{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         string(body),
+		Signature:    resp.Header.Get(SignatureHeader),
+	}
+
+	if signed && len(c.Signature) == 0 {
+		if c.Signature, err = fetchSignature(client, url); err != nil {
+			return nil, true, err
+		}
+	}
+
+	return c, false, nil
+}
+
+// cachedRemote returns the last good copy of a remote config, from memory or
+// the cache directory, or nil if there isn't one.
+func cachedRemote(url, dir string) *remoteConfig {
+	remoteLock.Lock()
+	c, ok := remoteCache[url]
+	remoteLock.Unlock()
+	if ok || len(dir) == 0 {
+		return c
+	}
+
+	data, err := ioutil.ReadFile(remoteCachePath(dir, url))
+	if err != nil {
+		return nil
+	}
+
+	c = &remoteConfig{}
+	if err := json.Unmarshal(data, c); err != nil || c.URL != url {
+		return nil
+	}
+	return c
+}
+
+// saveRemote keeps a copy of a remote config which loaded successfully, and
+// writes it to the cache directory if it's set.
+func saveRemote(c *remoteConfig) error {
+	remoteLock.Lock()
+	dir := remote.CacheDir
+	unchanged := remoteCache[c.URL] == c
+	remoteCache[c.URL] = c
+	remoteLock.Unlock()
+
+	if unchanged || len(dir) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	/* Write to a temporary file first so a crash can't corrupt the cache */
+	path := remoteCachePath(dir, c.URL)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// remoteCachePath returns the file the last good copy of a remote config is
+// cached in.
+func remoteCachePath(dir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, "config-"+hex.EncodeToString(sum[:8])+".json")
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useRemote sets the options remote configs are fetched with for a test,
+// forgetting any copies fetched before it.
+func useRemote(t *testing.T, o RemoteOptions) {
+	reset := func(o RemoteOptions) {
+		remoteLock.Lock()
+		defer remoteLock.Unlock()
+
+		remote = o
+		remoteCache = make(map[string]*remoteConfig)
+	}
+
+	old := remoteOptions()
+	reset(o)
+	t.Cleanup(func() { reset(old) })
+}
+
+// forgetRemote drops the copies of remote configs kept in memory, as if the
+// bot had been restarted.
+func forgetRemote() {
+	remoteLock.Lock()
+	defer remoteLock.Unlock()
+
+	remoteCache = make(map[string]*remoteConfig)
+}
+
+func TestRemoteNotModified(t *testing.T) {
+	useRemote(t, RemoteOptions{Timeout: time.Second})
+
+	var fetches, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			atomic.AddInt32(&fetches, 1)
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`{"owners": ["1"]}`))
+		},
+	))
+	defer srv.Close()
+
+	for i := 0; i < 3; i++ {
+		cfg, err := Load(srv.URL+"/config.json", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cfg.Owners, []string{"1"}) {
+			t.Errorf("unexpected owners %v", cfg.Owners)
+		}
+	}
+
+	if fetches != 1 || notModified != 2 {
+		t.Errorf("expected 1 download and 2 unchanged responses, got %d and %d",
+			fetches, notModified)
+	}
+}
+
+func TestRemoteCache(t *testing.T) {
+	dir := t.TempDir()
+	useRemote(t, RemoteOptions{Timeout: time.Second, CacheDir: dir})
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"owners": ["1"]}`))
+		},
+	))
+	url := srv.URL + "/config.json"
+
+	if _, err := Load(url, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	/* The server goes away, and the bot is restarted */
+	srv.Close()
+	forgetRemote()
+
+	cfg, err := Load(url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Owners, []string{"1"}) {
+		t.Errorf("unexpected owners %v", cfg.Owners)
+	}
+	if len(cfg.Warnings) != 1 ||
+		!strings.Contains(cfg.Warnings[0].Message, "using the copy from") {
+		t.Errorf("expected a warning about the cached copy, got %v", cfg.Warnings)
+	}
+
+	/* Without a cached copy, the config can't be loaded */
+	useRemote(t, RemoteOptions{Timeout: time.Second})
+	if _, err := Load(url, ""); err == nil {
+		t.Error("expected the config not to load without a cached copy")
+	}
+}
+
+func TestRemoteStatus(t *testing.T) {
+	tests := []struct {
+		status, requests int
+	}{
+		{http.StatusNotFound, 1},
+		{http.StatusForbidden, 1},
+		{http.StatusTooManyRequests, 3},
+		{http.StatusInternalServerError, 3},
+		{http.StatusBadGateway, 3},
+	}
+
+	useRemote(t, RemoteOptions{
+		Timeout: time.Second, Retries: 2, Backoff: time.Millisecond,
+	})
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&requests, 1)
+					w.WriteHeader(tt.status)
+				},
+			))
+			defer srv.Close()
+
+			_, err := Load(srv.URL+"/config.json", "")
+			if err == nil || !strings.Contains(err.Error(), "unexpected status") {
+				t.Errorf("expected an unexpected status error, got %v", err)
+			}
+			if int(requests) != tt.requests {
+				t.Errorf("expected %d requests, got %d", tt.requests, requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
+
+	"github.com/tidwall/gjson"
+)
+
+type (
+	// Problem is something wrong with a config, found by Validate. Warnings
+	// (such as unknown keys) don't stop the config from being loaded. File is
+	// the file (or URL) the problem is in, if known.
+	Problem struct {
+		File    string
+		Path    string
+		Message string
+		Warning bool
+	}
+
+	// ValidationError is returned when a config has problems which stop it
+	// from being loaded.
+	ValidationError struct {
+		Problems []Problem
+	}
+
+	// schema describes what a value in the config should look like. Objects
+	// either have a fixed set of Fields (of which those in Required must be
+	// set) or any keys with values matching Values. Values matching any of
+	// OneOf are accepted.
+	schema struct {
+		Type     string
+		Fields   map[string]*schema
+		Required []string
+		Values   *schema
+		Items    *schema
+		OneOf    []*schema
+		Check    func(gjson.Result) error
+	}
+)
+
+var (
+	stringList   = &schema{Type: "array", Items: &schema{Type: "string"}}
+	stringOrList = &schema{OneOf: []*schema{{Type: "string"}, stringList}}
+
+	/* Prefixes, which would match every message if left blank */
+	prefix       = &schema{Type: "string", Check: checkPrefix}
+	prefixOrList = &schema{OneOf: []*schema{
+		prefix, {Type: "array", Items: prefix},
+	}}
+
+	/* Discord IDs, which are usually left unquoted in YAML and TOML */
+	idNumber = &schema{Type: "number", Check: checkID}
+	idList   = &schema{Type: "array", Items: &schema{
+		OneOf: []*schema{{Type: "string"}, idNumber},
+	}}
+	idOrList = &schema{OneOf: []*schema{{Type: "string"}, idNumber, idList}}
+
+	ruleList = &schema{Type: "array", Items: &schema{
+		Type: "string",
+		Check: func(v gjson.Result) error {
+			_, err := multiplexer.ParseRule(v.String())
+			return err
+		},
+	}}
+
+	permissionLists = map[string]*schema{
+		"users":    idOrList,
+		"roles":    idOrList,
+		"channels": idOrList,
+	}
+
+	permissionsSchema = &schema{Type: "object", Values: &schema{
+		OneOf: []*schema{idList, {Type: "object", Fields: merge(
+			permissionLists,
+			map[string]*schema{
+				"deny":       {Type: "object", Fields: permissionLists},
+				"precedence": ruleList,
+			},
+		)}},
+	}}
+
+	embedSchema = &schema{Type: "object", Fields: map[string]*schema{
+		"title":       {Type: "string"},
+		"description": {Type: "string"},
+		"url":         {Type: "string"},
+		"color": {Check: func(v gjson.Result) error {
+			_, err := parseColor(v)
+			return err
+		}},
+		"image":     {Type: "string"},
+		"thumbnail": {Type: "string"},
+		"footer":    {Type: "string"},
+		"fields": {Type: "array", Items: &schema{
+			Type:     "object",
+			Required: []string{"name", "value"},
+			Fields: map[string]*schema{
+				"name":   {Type: "string"},
+				"value":  {Type: "string"},
+				"inline": {Type: "bool"},
+			},
+		}},
+	}}
+
+	simpleCommandsSchema = &schema{Type: "object", Values: &schema{
+		OneOf: []*schema{{Type: "string"}, {
+			Type: "object",
+			Fields: map[string]*schema{
+				"content":   {Type: "string"},
+				"responses": stringList,
+				"embed":     embedSchema,
+				"help":      {Type: "string"},
+				"aliases":   stringOrList,
+				"template":  {Type: "bool"},
+			},
+			Check: checkSimpleCommand,
+		}},
+	}}
+
+	limitSchema = &schema{
+		Type:     "object",
+		Required: []string{"limit", "window"},
+		Fields: map[string]*schema{
+			"type": {Type: "string", Check: func(v gjson.Result) error {
+				_, err := multiplexer.ParseLimitType(v.String())
+				return err
+			}},
+			"limit": {Type: "number", Check: func(v gjson.Result) error {
+				if v.Int() <= 0 || float64(v.Int()) != v.Float() {
+					return fmt.Errorf("must be a whole number above 0")
+				}
+				return nil
+			}},
+			"window": {Type: "string", Check: func(v gjson.Result) error {
+				d, err := time.ParseDuration(v.String())
+				if err != nil {
+					return fmt.Errorf("must be a duration such as \"30s\" or \"5m\"")
+				}
+				if d <= 0 {
+					return fmt.Errorf("must be above 0")
+				}
+				return nil
+			}},
+			"scope": {Type: "string", Check: func(v gjson.Result) error {
+				_, err := multiplexer.ParseLimitScope(v.String())
+				return err
+			}},
+		},
+	}
+
+	guildSchema = &schema{Type: "object", Fields: map[string]*schema{
+		"prefixes":         prefixOrList,
+		"simpleCommands":   simpleCommandsSchema,
+		"permissions":      permissionsSchema,
+		"disabledCommands": stringOrList,
+	}}
+
+	// configSchema describes the whole config file.
+	configSchema = &schema{Type: "object", Fields: map[string]*schema{
+		"include":        stringOrList,
+		"owners":         idOrList,
+		"prefixes":       prefixOrList,
+		"simpleCommands": simpleCommandsSchema,
+		"permissions":    permissionsSchema,
+		"rateLimits": {Type: "object", Fields: map[string]*schema{
+			"global":   limitSchema,
+			"commands": {Type: "object", Values: limitSchema},
+			"guilds":   {Type: "object", Values: limitSchema},
+		}},
+		"guilds": {Type: "object", Values: guildSchema},
+		"guildPrefixes": {
+			Type:   "object",
+			Values: prefixOrList,
+		},
+	}}
+
+	/* Keys which can be written as .key in a path */
+	plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Validate checks a config against the schema, returning every problem found
+// in it along with the path to it (e.g. `permissions["role add"].users[0]`).
+func Validate(json string) []Problem {
+	if !gjson.Valid(json) {
+		return []Problem{{Message: "not valid JSON"}}
+	}
+
+	var problems []Problem
+	configSchema.validate("", gjson.Parse(json), &problems)
+	return problems
+}
+
+// Error lists the problems which stopped the config from being loaded.
+func (e *ValidationError) Error() string {
+	var lines []string
+	for _, p := range e.Problems {
+		if !p.Warning {
+			lines = append(lines, p.String())
+		}
+	}
+	return "invalid config: " + strings.Join(lines, "; ")
+}
+
+// String describes the problem, e.g. `config.json: owners[1]: must be a
+// string`.
+func (p Problem) String() string {
+	path := p.Path
+	switch {
+	case len(p.File) > 0 && len(path) == 0:
+		path = p.File
+	case len(p.File) > 0:
+		path = p.File + ": " + path
+	case len(path) == 0:
+		path = "(root)"
+	}
+
+	if p.Warning {
+		return path + ": " + p.Message + " (warning)"
+	}
+	return path + ": " + p.Message
+}
+
+/* === Helper Functions === */
+
+// checkSimpleCommand checks that a simple command object has something to
+// reply with, and that its templates (unless it isn't templated) are valid.
+func checkSimpleCommand(v gjson.Result) error {
+	if !v.Get("content").Exists() && !v.Get("responses").Exists() &&
+		!v.Get("embed").Exists() {
+		return fmt.Errorf("must have content, responses or an embed")
+	}
+
+	if v.Get("template").Type == gjson.False {
+		return nil
+	}
+
+	for _, path := range []string{
+		"content", "responses", "embed.title", "embed.description",
+		"embed.footer", "embed.fields.#.name", "embed.fields.#.value",
+	} {
+		for _, text := range getStrings(v.Get(path)) {
+			if _, err := multiplexer.ParseTemplate(text); err != nil {
+				return fmt.Errorf("invalid template in %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks a value against the schema, adding any problems found.
+func (s *schema) validate(path string, v gjson.Result, problems *[]Problem) {
+	if len(s.OneOf) > 0 {
+		s.validateOneOf(path, v, problems)
+		return
+	}
+
+	if !hasType(v, s.Type) {
+		*problems = append(*problems, Problem{
+			Path: path, Message: "must be " + article(s.Type),
+		})
+		return
+	}
+
+	if s.Check != nil {
+		if err := s.Check(v); err != nil {
+			*problems = append(*problems, Problem{Path: path, Message: err.Error()})
+		}
+	}
+
+	switch {
+	case s.Type == "array" && s.Items != nil:
+		for i, item := range v.Array() {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+		}
+
+	case s.Type == "object":
+		s.validateObject(path, v, problems)
+	}
+}
+
+// validateObject checks each key of an object, warning about any the schema
+// doesn't know about.
+func (s *schema) validateObject(path string, v gjson.Result, problems *[]Problem) {
+	/* Sort the keys so problems are always reported in the same order */
+	m := v.Map()
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		child := joinPath(path, k)
+
+		field := s.Values
+		if s.Fields != nil {
+			field = s.Fields[k]
+		}
+
+		if field == nil {
+			*problems = append(*problems, Problem{
+				Path: child, Message: "unknown key", Warning: true,
+			})
+			continue
+		}
+		field.validate(child, m[k], problems)
+	}
+
+	for _, k := range s.Required {
+		if _, ok := m[k]; !ok {
+			*problems = append(*problems, Problem{
+				Path: joinPath(path, k), Message: "is required",
+			})
+		}
+	}
+}
+
+// validateOneOf checks a value against each of the alternatives. If none of
+// them match the value's type, the problem lists what was expected. Otherwise,
+// the problems from the first alternative of the right type are reported.
+func (s *schema) validateOneOf(path string, v gjson.Result, problems *[]Problem) {
+	var types []string
+	for _, alt := range s.OneOf {
+		if hasType(v, alt.Type) {
+			alt.validate(path, v, problems)
+			return
+		}
+		types = append(types, article(alt.Type))
+	}
+
+	*problems = append(*problems, Problem{
+		Path: path, Message: "must be " + strings.Join(types, " or "),
+	})
+}
+
+// checkID checks an ID written as a number is a whole number, which is kept
+// exactly as it's written.
+func checkID(v gjson.Result) error {
+	for _, c := range v.Raw {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("must be a whole number, or a string")
+		}
+	}
+	return nil
+}
+
+// checkPrefix checks that a prefix isn't empty or only whitespace.
+func checkPrefix(v gjson.Result) error {
+	if len(strings.TrimSpace(v.String())) == 0 {
+		return fmt.Errorf("can't be empty")
+	}
+	return nil
+}
+
+// hasType checks if the value is of the type named in a schema.
+func hasType(v gjson.Result, t string) bool {
+	switch t {
+	case "object":
+		return v.IsObject()
+	case "array":
+		return v.IsArray()
+	case "string":
+		return v.Type == gjson.String
+	case "number":
+		return v.Type == gjson.Number
+	case "bool":
+		return v.Type == gjson.True || v.Type == gjson.False
+	default:
+		return true
+	}
+}
+
+// article adds "a" or "an" to the name of a type.
+func article(t string) string {
+	switch t {
+	case "array", "object":
+		return "an " + t
+	default:
+		return "a " + t
+	}
+}
+
+// joinPath adds a key to a path, quoting it if it isn't a plain identifier.
+func joinPath(path, key string) string {
+	if !plainKey.MatchString(key) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+// merge combines maps of fields into one.
+func merge(maps ...map[string]*schema) map[string]*schema {
+	out := make(map[string]*schema)
+	for _, m := range maps {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// SignatureHeader is the response header a remote config's signature can
+	// be sent in. If it isn't set, the signature is fetched from the config's
+	// URL with SignatureExt added to the end of the path.
+	SignatureHeader = "X-Config-Signature"
+
+	// SignatureExt is added to the end of a config's path (or URL) to get the
+	// path of its detached signature.
+	SignatureExt = ".sig"
+)
+
+// ParsePublicKey reads a base64 encoded ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := decodeKey(s, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// ParsePrivateKey reads a base64 encoded ed25519 private key, either in full
+// or just its seed.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	key, err := decodeKey(s, ed25519.PrivateKeySize, ed25519.SeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	if len(key) == ed25519.SeedSize {
+		return ed25519.NewKeyFromSeed(key), nil
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// Sign signs a config, returning the base64 encoded detached signature.
+func Sign(config []byte, key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, config))
+}
+
+// Verify checks a base64 encoded detached signature of a config.
+func Verify(config []byte, signature string, key ed25519.PublicKey) error {
+	if len(strings.TrimSpace(signature)) == 0 {
+		return fmt.Errorf("config isn't signed")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("config signature is malformed")
+	}
+
+	if !ed25519.Verify(key, config, sig) {
+		return fmt.Errorf("config signature doesn't match")
+	}
+	return nil
+}
+
+/* === Helper Functions === */
+
+// fetchSignature fetches the detached signature of a remote config from the
+// URL next to it. A missing signature isn't an error, so unsigned configs can
+// be told apart from servers which can't be reached.
+func fetchSignature(client *http.Client, configURL string) (string, error) {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path += SignatureExt
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status %s fetching signature", resp.Status)
+	}
+
+	sig, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(sig)), nil
+}
+
+// decodeKey decodes a base64 key, checking that it's one of the sizes given.
+func decodeKey(s string, sizes ...int) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, size := range sizes {
+		if len(key) == size {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("wrong length (%d bytes)", len(key))
+}
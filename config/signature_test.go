@@ -0,0 +1,224 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newKey generates a key pair to sign configs with.
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public, private
+}
+
+func TestVerify(t *testing.T) {
+	public, private := newKey(t)
+	other, _ := newKey(t)
+
+	config := []byte(`{"owners": ["1"]}`)
+	signature := Sign(config, private)
+
+	tests := []struct {
+		name      string
+		config    []byte
+		signature string
+		key       ed25519.PublicKey
+		problem   string
+	}{
+		{
+			name: "valid", config: config, signature: signature, key: public,
+		},
+		{
+			name: "valid with whitespace", config: config,
+			signature: signature + "\n", key: public,
+		},
+		{
+			name: "tampered", config: []byte(`{"owners": ["2"]}`),
+			signature: signature, key: public,
+			problem: "doesn't match",
+		},
+		{
+			name: "missing", config: config, key: public,
+			problem: "isn't signed",
+		},
+		{
+			name: "not base64", config: config, signature: "not a signature",
+			key:     public,
+			problem: "malformed",
+		},
+		{
+			name: "wrong length", config: config,
+			signature: base64.StdEncoding.EncodeToString([]byte("short")),
+			key:       public,
+			problem:   "malformed",
+		},
+		{
+			name: "wrong key", config: config, signature: signature, key: other,
+			problem: "doesn't match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.config, tt.signature, tt.key)
+			if len(tt.problem) == 0 && err != nil {
+				t.Error(err)
+			} else if len(tt.problem) > 0 &&
+				(err == nil || !strings.Contains(err.Error(), tt.problem)) {
+				t.Errorf("expected %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	public, private := newKey(t)
+	encode := base64.StdEncoding.EncodeToString
+
+	for _, s := range []string{encode(private), encode(private.Seed())} {
+		key, err := ParsePrivateKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.Equal(private) {
+			t.Error("expected the private key to match")
+		}
+	}
+
+	key, err := ParsePublicKey(encode(public) + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(public) {
+		t.Error("expected the public key to match")
+	}
+
+	if _, err := ParsePublicKey(encode(private.Seed()[:16])); err == nil {
+		t.Error("expected a short key to be rejected")
+	}
+	if _, err := ParsePrivateKey("not a key"); err == nil {
+		t.Error("expected an invalid key to be rejected")
+	}
+}
+
+func TestSignedRemote(t *testing.T) {
+	public, private := newKey(t)
+	_, wrong := newKey(t)
+
+	config := `{"owners": ["1"]}`
+	tests := []struct {
+		name    string
+		header  string
+		sigFile string
+		problem string
+	}{
+		{name: "signature header", header: Sign([]byte(config), private)},
+		{name: "signature file", sigFile: Sign([]byte(config), private)},
+		{
+			name:    "tampered",
+			header:  Sign([]byte(`{"owners": ["2"]}`), private),
+			problem: "doesn't match",
+		},
+		{name: "unsigned", problem: "isn't signed"},
+		{
+			name:    "wrong key",
+			sigFile: Sign([]byte(config), wrong),
+			problem: "doesn't match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRemote(t, RemoteOptions{Timeout: time.Second, PublicKey: public})
+
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					switch {
+					case r.URL.Path == "/config.json"+SignatureExt &&
+						len(tt.sigFile) > 0:
+						w.Write([]byte(tt.sigFile + "\n"))
+					case r.URL.Path == "/config.json":
+						if len(tt.header) > 0 {
+							w.Header().Set(SignatureHeader, tt.header)
+						}
+						w.Write([]byte(config))
+					default:
+						http.NotFound(w, r)
+					}
+				},
+			))
+			defer srv.Close()
+
+			_, err := Load(srv.URL+"/config.json", "")
+			if len(tt.problem) == 0 && err != nil {
+				t.Error(err)
+			} else if len(tt.problem) > 0 &&
+				(err == nil || !strings.Contains(err.Error(), tt.problem)) {
+				t.Errorf("expected %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestSignedRemoteCache(t *testing.T) {
+	public, private := newKey(t)
+	dir := t.TempDir()
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	url := srv.URL + "/config.json"
+	srv.Close()
+
+	/* Someone with access to the cache changes the owners */
+	config := `{"owners": ["1"]}`
+	cached, _ := json.Marshal(&remoteConfig{
+		URL:       url,
+		Fetched:   time.Now(),
+		Body:      `{"owners": ["2"]}`,
+		Signature: Sign([]byte(config), private),
+	})
+	path := remoteCachePath(dir, url)
+	if err := ioutil.WriteFile(path, cached, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	useRemote(t, RemoteOptions{
+		Timeout: time.Second, CacheDir: dir, PublicKey: public,
+	})
+	_, err := Load(url, "")
+	if err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("expected the cached copy to be rejected, got %v", err)
+	}
+
+	/* The untouched copy is used */
+	cached, _ = json.Marshal(&remoteConfig{
+		URL:       url,
+		Fetched:   time.Now(),
+		Body:      config,
+		Signature: Sign([]byte(config), private),
+	})
+	if err := ioutil.WriteFile(path, cached, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	forgetRemote()
+	cfg, err := Load(url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Owners) != 1 || cfg.Owners[0] != "1" {
+		t.Errorf("unexpected owners %v", cfg.Owners)
+	}
+}
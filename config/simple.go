@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/tidwall/gjson"
+)
+
+// SimpleHelpText is the help text of simple commands which don't set their
+// own.
+const SimpleHelpText = "This is a simple command"
+
+// NewSimpleCommand creates a simple command which just replies with the
+// content given, like a plain string entry in the config.
+func NewSimpleCommand(name, content string) multiplexer.SimpleCommand {
+	return multiplexer.SimpleCommand{
+		Command:  name,
+		Content:  content,
+		HelpText: SimpleHelpText,
+	}
+}
+
+/* === Helper Functions === */
+
+// getSimpleCommands reads an object of simple commands, keyed by name. Each
+// is either a string to reply with, or an object with any of "content",
+// "responses" (picked from at random), "embed", "help" and "aliases". The text
+// of objects is templated unless "template" is false.
+func getSimpleCommands(
+	value gjson.Result,
+) (map[string]multiplexer.SimpleCommand, error) {
+	out := make(map[string]multiplexer.SimpleCommand)
+	var err error
+
+	value.ForEach(func(key, value gjson.Result) bool {
+		var s multiplexer.SimpleCommand
+		s, err = getSimpleCommand(key.String(), value)
+		if err != nil {
+			err = fmt.Errorf("simple command %q: %w", key.String(), err)
+			return false
+		}
+
+		out[key.String()] = s
+		return true
+	})
+	return out, err
+}
+
+// getSimpleCommand reads a single simple command.
+func getSimpleCommand(
+	name string, value gjson.Result,
+) (multiplexer.SimpleCommand, error) {
+	s := NewSimpleCommand(name, value.String())
+	if !value.IsObject() {
+		return s, nil
+	}
+
+	s.Content = value.Get("content").String()
+	s.Responses = getStrings(value.Get("responses"))
+	s.Aliases = getStrings(value.Get("aliases"))
+	s.Template = value.Get("template").Type != gjson.False
+
+	if help := value.Get("help"); help.Exists() {
+		s.HelpText = help.String()
+	}
+
+	if e := value.Get("embed"); e.Exists() {
+		embed, err := getEmbed(e)
+		if err != nil {
+			return s, err
+		}
+		s.Embed = embed
+	}
+
+	if !s.Template {
+		return s, nil
+	}
+
+	for _, text := range simpleTexts(s) {
+		if _, err := multiplexer.ParseTemplate(text); err != nil {
+			return s, err
+		}
+	}
+
+	return s, nil
+}
+
+// simpleTexts returns every piece of text in a simple command which can be
+// templated.
+func simpleTexts(s multiplexer.SimpleCommand) []string {
+	texts := append([]string{s.Content}, s.Responses...)
+	if e := s.Embed; e != nil {
+		texts = append(texts, e.Title, e.Description)
+		for _, f := range e.Fields {
+			texts = append(texts, f.Name, f.Value)
+		}
+		if e.Footer != nil {
+			texts = append(texts, e.Footer.Text)
+		}
+	}
+	return texts
+}
+
+// getEmbed reads the embed of a simple command.
+func getEmbed(value gjson.Result) (*discordgo.MessageEmbed, error) {
+	embed := &discordgo.MessageEmbed{
+		Type:        discordgo.EmbedTypeRich,
+		Title:       value.Get("title").String(),
+		Description: value.Get("description").String(),
+		URL:         value.Get("url").String(),
+	}
+
+	if c := value.Get("color"); c.Exists() {
+		color, err := parseColor(c)
+		if err != nil {
+			return nil, err
+		}
+		embed.Color = color
+	}
+
+	if image := value.Get("image"); image.Exists() {
+		embed.Image = &discordgo.MessageEmbedImage{URL: image.String()}
+	}
+	if thumb := value.Get("thumbnail"); thumb.Exists() {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: thumb.String()}
+	}
+	if footer := value.Get("footer"); footer.Exists() {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: footer.String()}
+	}
+
+	for _, f := range value.Get("fields").Array() {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   f.Get("name").String(),
+			Value:  f.Get("value").String(),
+			Inline: f.Get("inline").Bool(),
+		})
+	}
+
+	return embed, nil
+}
+
+// parseColor reads an embed color, either a number or a hex string such as
+// "#5865F2".
+func parseColor(value gjson.Result) (int, error) {
+	if value.Type == gjson.Number {
+		color := value.Int()
+		if color < 0 || color > 0xFFFFFF {
+			return 0, fmt.Errorf("color must be between 0 and 0xFFFFFF")
+		}
+		return int(color), nil
+	}
+
+	hex := strings.TrimPrefix(value.String(), "#")
+	color, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return 0, fmt.Errorf("color must be a hex color such as \"#5865F2\"")
+	}
+	return int(color), nil
+}
+
+// simpleCommandJSON converts a simple command back into the format it's read
+// in, which is just its content for plain commands.
+func simpleCommandJSON(s multiplexer.SimpleCommand) interface{} {
+	if len(s.Responses) == 0 && s.Embed == nil && !s.Template &&
+		len(s.Aliases) == 0 && s.HelpText == SimpleHelpText {
+		return s.Content
+	}
+
+	out := make(map[string]interface{})
+	if len(s.Content) > 0 {
+		out["content"] = s.Content
+	}
+	if len(s.Responses) > 0 {
+		out["responses"] = s.Responses
+	}
+	if len(s.Aliases) > 0 {
+		out["aliases"] = s.Aliases
+	}
+	if s.HelpText != SimpleHelpText {
+		out["help"] = s.HelpText
+	}
+	if !s.Template {
+		out["template"] = false
+	}
+
+	if e := s.Embed; e != nil {
+		embed := make(map[string]interface{})
+		for k, v := range map[string]string{
+			"title":       e.Title,
+			"description": e.Description,
+			"url":         e.URL,
+		} {
+			if len(v) > 0 {
+				embed[k] = v
+			}
+		}
+
+		if e.Color != 0 {
+			embed["color"] = fmt.Sprintf("#%06X", e.Color)
+		}
+		if e.Image != nil {
+			embed["image"] = e.Image.URL
+		}
+		if e.Thumbnail != nil {
+			embed["thumbnail"] = e.Thumbnail.URL
+		}
+		if e.Footer != nil {
+			embed["footer"] = e.Footer.Text
+		}
+
+		var fields []interface{}
+		for _, f := range e.Fields {
+			fields = append(fields, map[string]interface{}{
+				"name": f.Name, "value": f.Value, "inline": f.Inline,
+			})
+		}
+		if len(fields) > 0 {
+			embed["fields"] = fields
+		}
+		out["embed"] = embed
+	}
+
+	return out
+}
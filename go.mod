@@ -1,11 +1,11 @@
 module github.com/PulseDevelopmentGroup/Build-A-Bot
 
-go 1.14
+go 1.16
 
 require (
-	github.com/bwmarrin/discordgo v0.21.1
+	github.com/BurntSushi/toml v1.3.2
+	github.com/bwmarrin/discordgo v0.27.1
 	github.com/caarlos0/env/v6 v6.3.0
-	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/joho/godotenv v1.3.0
 	github.com/kr/text v0.2.0 // indirect
 	github.com/kylelemons/godebug v1.1.0 // indirect
@@ -15,7 +15,6 @@ require (
 	github.com/sirupsen/logrus v1.6.0
 	github.com/tidwall/gjson v1.6.0
 	github.com/tidwall/pretty v1.0.1 // indirect
-	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899 // indirect
-	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -12,6 +12,7 @@ type Logs struct {
 	Primary     *logrus.Logger
 	Command     *logrus.Entry
 	Multiplexer *logrus.Entry
+	Config      *logrus.Entry
 
 	debug bool
 }
@@ -37,6 +38,7 @@ func New(debug bool) *Logs {
 		Primary:     primary,
 		Command:     primary.WithField("type", "command"),
 		Multiplexer: primary.WithField("type", "multiplexer"),
+		Config:      primary.WithField("type", "config"),
 		debug:       debug,
 	}
 }
@@ -0,0 +1,323 @@
+package multiplexer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// ArgumentType specifies how the text of an argument should be parsed.
+	ArgumentType int
+
+	// Argument describes a single argument accepted by a command. Arguments are
+	// matched positionally in the order they are declared. Optional arguments
+	// must come after required ones, and only the last argument may be
+	// variadic. Mux.Register refuses commands which break these rules.
+	Argument struct {
+		Name, HelpText string
+		Type           ArgumentType
+		Required       bool
+		Variadic       bool
+
+		/* Default is parsed like user input when an optional argument is omitted */
+		Default string
+	}
+
+	// ArgumentError is returned when the arguments supplied to a command don't
+	// match its argument specification.
+	ArgumentError struct {
+		Argument *Argument
+		Reason   string
+	}
+)
+
+// Supported argument types
+const (
+	ArgString ArgumentType = iota
+	ArgInt
+	ArgBool
+	ArgDuration
+	ArgUser
+	ArgChannel
+	ArgRole
+)
+
+var (
+	userMention    = regexp.MustCompile(`^<@!?(\d+)>$`)
+	channelMention = regexp.MustCompile(`^<#(\d+)>$`)
+	roleMention    = regexp.MustCompile(`^<@&(\d+)>$`)
+	snowflake      = regexp.MustCompile(`^\d+$`)
+)
+
+// String returns the name of the argument type as shown in usage messages.
+func (t ArgumentType) String() string {
+	switch t {
+	case ArgInt:
+		return "number"
+	case ArgBool:
+		return "yes/no"
+	case ArgDuration:
+		return "duration"
+	case ArgUser:
+		return "@user"
+	case ArgChannel:
+		return "#channel"
+	case ArgRole:
+		return "@role"
+	default:
+		return "text"
+	}
+}
+
+func (e *ArgumentError) Error() string {
+	if e.Argument == nil {
+		return e.Reason
+	}
+	return fmt.Sprintf("%s: %s", e.Argument.Name, e.Reason)
+}
+
+// Usage builds a usage string for the command from its argument
+// specification, e.g. "!remind <when:duration> [message:text...]".
+func (cs *CommandSettings) Usage(prefix string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix + cs.Command)
+
+	for _, a := range cs.Arguments {
+		open, close := "[", "]"
+		if a.Required {
+			open, close = "<", ">"
+		}
+
+		sb.WriteString(" " + open + a.Name)
+		if a.Type != ArgString {
+			sb.WriteString(":" + a.Type.String())
+		}
+		if a.Variadic {
+			sb.WriteString("...")
+		}
+		sb.WriteString(close)
+	}
+
+	return sb.String()
+}
+
+// validateArguments checks that an argument specification can be parsed:
+// every argument has a unique name, optional arguments come after required
+// ones, only the last argument is variadic, and defaults are valid.
+func validateArguments(specs []Argument) error {
+	seen := make(map[string]bool)
+	optional := false
+
+	for i := range specs {
+		spec := &specs[i]
+
+		name := strings.ToLower(spec.Name)
+		if len(name) == 0 {
+			return fmt.Errorf("argument %d has no name", i+1)
+		}
+		if seen[name] {
+			return fmt.Errorf("argument %q is declared more than once", spec.Name)
+		}
+		seen[name] = true
+
+		if spec.Required && optional {
+			return fmt.Errorf(
+				"required argument %q comes after an optional one", spec.Name,
+			)
+		}
+		optional = optional || !spec.Required
+
+		if spec.Variadic && i != len(specs)-1 {
+			return fmt.Errorf(
+				"variadic argument %q isn't the last argument", spec.Name,
+			)
+		}
+
+		if len(spec.Default) != 0 {
+			if _, err := parseArgument(spec, spec.Default); err != nil {
+				return fmt.Errorf("invalid default: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseArguments matches the supplied arguments against the argument
+// specification and converts each one to its declared type. Every parsed
+// argument is stored as a slice to accommodate variadic arguments.
+func parseArguments(
+	specs []Argument, args []string,
+) (map[string][]interface{}, error) {
+	out := make(map[string][]interface{})
+
+	i := 0
+	for s := range specs {
+		spec := &specs[s]
+
+		/* Argument omitted, use the default if there is one */
+		if i >= len(args) {
+			if spec.Required {
+				return out, &ArgumentError{spec, "missing required argument"}
+			}
+
+			if len(spec.Default) != 0 {
+				v, err := parseArgument(spec, spec.Default)
+				if err != nil {
+					return out, err
+				}
+				out[spec.Name] = []interface{}{v}
+			}
+			continue
+		}
+
+		/* Variadic arguments consume everything left over */
+		end := i + 1
+		if spec.Variadic {
+			end = len(args)
+		}
+
+		for ; i < end; i++ {
+			v, err := parseArgument(spec, args[i])
+			if err != nil {
+				return out, err
+			}
+			out[spec.Name] = append(out[spec.Name], v)
+		}
+	}
+
+	if i < len(args) {
+		return out, &ArgumentError{
+			Reason: fmt.Sprintf("too many arguments (unexpected `%s`)", args[i]),
+		}
+	}
+
+	return out, nil
+}
+
+// parseArgument converts a single argument to the type specified.
+func parseArgument(spec *Argument, arg string) (interface{}, error) {
+	switch spec.Type {
+	case ArgInt:
+		v, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, &ArgumentError{spec, fmt.Sprintf("`%s` is not a number", arg)}
+		}
+		return v, nil
+
+	case ArgBool:
+		switch strings.ToLower(arg) {
+		case "true", "yes", "y", "on", "1":
+			return true, nil
+		case "false", "no", "n", "off", "0":
+			return false, nil
+		}
+		return nil, &ArgumentError{spec, fmt.Sprintf("`%s` is not yes or no", arg)}
+
+	case ArgDuration:
+		v, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, &ArgumentError{
+				spec, fmt.Sprintf("`%s` is not a duration (e.g. 10m, 1h30m)", arg),
+			}
+		}
+		return v, nil
+
+	case ArgUser:
+		return parseMention(spec, arg, userMention, "user")
+
+	case ArgChannel:
+		return parseMention(spec, arg, channelMention, "channel")
+
+	case ArgRole:
+		return parseMention(spec, arg, roleMention, "role")
+
+	default:
+		return arg, nil
+	}
+}
+
+// parseMention extracts the ID from a mention, or accepts a bare ID.
+func parseMention(
+	spec *Argument, arg string, pattern *regexp.Regexp, kind string,
+) (string, error) {
+	if m := pattern.FindStringSubmatch(arg); m != nil {
+		return m[1], nil
+	}
+
+	if snowflake.MatchString(arg) {
+		return arg, nil
+	}
+
+	return "", &ArgumentError{
+		spec, fmt.Sprintf("`%s` is not a %s mention or ID", arg, kind),
+	}
+}
+
+/* === Context Accessors === */
+
+// Has checks if a value was supplied (or defaulted) for the named argument.
+func (ctx *Context) Has(name string) bool {
+	_, ok := ctx.parsed[name]
+	return ok
+}
+
+// List returns every value of the named argument. Useful for variadic
+// arguments.
+func (ctx *Context) List(name string) []interface{} {
+	return ctx.parsed[name]
+}
+
+// String returns the value of the named argument as a string. Returns an empty
+// string if the argument is not present.
+func (ctx *Context) String(name string) string {
+	v, _ := ctx.value(name).(string)
+	return v
+}
+
+// Int returns the value of the named number argument. Returns 0 if the argument
+// is not present.
+func (ctx *Context) Int(name string) int {
+	v, _ := ctx.value(name).(int)
+	return v
+}
+
+// Bool returns the value of the named yes/no argument. Returns false if the
+// argument is not present.
+func (ctx *Context) Bool(name string) bool {
+	v, _ := ctx.value(name).(bool)
+	return v
+}
+
+// Duration returns the value of the named duration argument. Returns 0 if the
+// argument is not present.
+func (ctx *Context) Duration(name string) time.Duration {
+	v, _ := ctx.value(name).(time.Duration)
+	return v
+}
+
+// User returns the user ID of the named user argument.
+func (ctx *Context) User(name string) string {
+	return ctx.String(name)
+}
+
+// Channel returns the channel ID of the named channel argument.
+func (ctx *Context) Channel(name string) string {
+	return ctx.String(name)
+}
+
+// Role returns the role ID of the named role argument.
+func (ctx *Context) Role(name string) string {
+	return ctx.String(name)
+}
+
+// value returns the first value of the named argument, or nil.
+func (ctx *Context) value(name string) interface{} {
+	if v := ctx.parsed[name]; len(v) > 0 {
+		return v[0]
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package multiplexer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArguments(t *testing.T) {
+	remind := []Argument{
+		{Name: "when", Type: ArgDuration, Required: true},
+		{Name: "times", Type: ArgInt, Default: "1"},
+		{Name: "message", Type: ArgString, Variadic: true},
+	}
+	mentions := []Argument{
+		{Name: "user", Type: ArgUser, Required: true},
+		{Name: "channel", Type: ArgChannel},
+		{Name: "role", Type: ArgRole},
+		{Name: "loud", Type: ArgBool},
+	}
+
+	tests := []struct {
+		name     string
+		specs    []Argument
+		args     []string
+		expected map[string][]interface{}
+		problem  string
+	}{
+		{
+			name:  "optional arguments omitted",
+			specs: remind,
+			args:  []string{"10m"},
+			expected: map[string][]interface{}{
+				"when": {10 * time.Minute}, "times": {1},
+			},
+		},
+		{
+			name:  "rest of the line",
+			specs: remind,
+			args:  []string{"1h30m", "2", "stand", "up", "now"},
+			expected: map[string][]interface{}{
+				"when":    {90 * time.Minute},
+				"times":   {2},
+				"message": {"stand", "up", "now"},
+			},
+		},
+		{
+			name:    "required argument missing",
+			specs:   remind,
+			problem: "when: missing required argument",
+		},
+		{
+			name:    "bad duration",
+			specs:   remind,
+			args:    []string{"soon"},
+			problem: "when: `soon` is not a duration",
+		},
+		{
+			name:    "bad int",
+			specs:   remind,
+			args:    []string{"10m", "twice"},
+			problem: "times: `twice` is not a number",
+		},
+		{
+			name:    "too many arguments",
+			specs:   remind[:2],
+			args:    []string{"10m", "2", "extra"},
+			problem: "too many arguments (unexpected `extra`)",
+		},
+		{
+			name:  "mentions and ids",
+			specs: mentions,
+			args:  []string{"<@!1>", "<#2>", "3", "yes"},
+			expected: map[string][]interface{}{
+				"user": {"1"}, "channel": {"2"}, "role": {"3"}, "loud": {true},
+			},
+		},
+		{
+			name:    "wrong kind of mention",
+			specs:   mentions,
+			args:    []string{"<#1>"},
+			problem: "user: `<#1>` is not a user mention or ID",
+		},
+		{
+			name:    "bad bool",
+			specs:   mentions,
+			args:    []string{"1", "2", "3", "maybe"},
+			problem: "loud: `maybe` is not yes or no",
+		},
+		{
+			name:     "no arguments",
+			args:     nil,
+			expected: map[string][]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseArguments(tt.specs, tt.args)
+			if len(tt.problem) > 0 {
+				if _, ok := err.(*ArgumentError); !ok ||
+					!strings.Contains(err.Error(), tt.problem) {
+					t.Errorf("expected %q, got %v", tt.problem, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateArguments(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []Argument
+		problem string
+	}{
+		{
+			name: "valid",
+			specs: []Argument{
+				{Name: "a", Required: true}, {Name: "b"},
+				{Name: "c", Variadic: true},
+			},
+		},
+		{
+			name:    "no name",
+			specs:   []Argument{{}},
+			problem: "has no name",
+		},
+		{
+			name:    "duplicate name",
+			specs:   []Argument{{Name: "a"}, {Name: "A"}},
+			problem: "declared more than once",
+		},
+		{
+			name:    "required after optional",
+			specs:   []Argument{{Name: "a"}, {Name: "b", Required: true}},
+			problem: "comes after an optional one",
+		},
+		{
+			name:    "variadic not last",
+			specs:   []Argument{{Name: "a", Variadic: true}, {Name: "b"}},
+			problem: "isn't the last argument",
+		},
+		{
+			name:    "bad default",
+			specs:   []Argument{{Name: "a", Type: ArgInt, Default: "x"}},
+			problem: "invalid default",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateArguments(tt.specs)
+			if len(tt.problem) == 0 && err != nil {
+				t.Error(err)
+			} else if len(tt.problem) > 0 &&
+				(err == nil || !strings.Contains(err.Error(), tt.problem)) {
+				t.Errorf("expected %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	cs := &CommandSettings{
+		Command: "remind",
+		Arguments: []Argument{
+			{Name: "when", Type: ArgDuration, Required: true},
+			{Name: "message", Variadic: true},
+		},
+	}
+
+	expected := "!remind <when:duration> [message...]"
+	if usage := cs.Usage("!"); usage != expected {
+		t.Errorf("expected %q, got %q", expected, usage)
+	}
+}
@@ -0,0 +1,235 @@
+package multiplexer
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// allPermissions has every permission flag set, including any added to
+// Discord after this was written.
+const allPermissions = ^int64(0)
+
+// permissionNames holds the user-readable names of the Discord permission
+// flags a command is likely to require.
+var permissionNames = []struct {
+	flag int64
+	name string
+}{
+	{discordgo.PermissionAdministrator, "Administrator"},
+	{discordgo.PermissionManageServer, "Manage Server"},
+	{discordgo.PermissionManageRoles, "Manage Roles"},
+	{discordgo.PermissionManageChannels, "Manage Channels"},
+	{discordgo.PermissionManageWebhooks, "Manage Webhooks"},
+	{discordgo.PermissionManageEmojis, "Manage Emojis"},
+	{discordgo.PermissionManageEvents, "Manage Events"},
+	{discordgo.PermissionManageThreads, "Manage Threads"},
+	{discordgo.PermissionManageMessages, "Manage Messages"},
+	{discordgo.PermissionManageNicknames, "Manage Nicknames"},
+	{discordgo.PermissionKickMembers, "Kick Members"},
+	{discordgo.PermissionBanMembers, "Ban Members"},
+	{discordgo.PermissionModerateMembers, "Timeout Members"},
+	{discordgo.PermissionViewAuditLogs, "View Audit Log"},
+	{discordgo.PermissionViewChannel, "View Channel"},
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionSendMessagesInThreads, "Send Messages in Threads"},
+	{discordgo.PermissionCreatePublicThreads, "Create Public Threads"},
+	{discordgo.PermissionCreatePrivateThreads, "Create Private Threads"},
+	{discordgo.PermissionEmbedLinks, "Embed Links"},
+	{discordgo.PermissionAttachFiles, "Attach Files"},
+	{discordgo.PermissionAddReactions, "Add Reactions"},
+	{discordgo.PermissionUseExternalEmojis, "Use External Emojis"},
+	{discordgo.PermissionMentionEveryone, "Mention Everyone"},
+	{discordgo.PermissionReadMessageHistory, "Read Message History"},
+	{discordgo.PermissionCreateInstantInvite, "Create Invite"},
+	{discordgo.PermissionChangeNickname, "Change Nickname"},
+	{discordgo.PermissionVoiceConnect, "Connect"},
+	{discordgo.PermissionVoiceSpeak, "Speak"},
+	{discordgo.PermissionVoiceMuteMembers, "Mute Members"},
+	{discordgo.PermissionVoiceDeafenMembers, "Deafen Members"},
+	{discordgo.PermissionVoiceMoveMembers, "Move Members"},
+}
+
+// PermissionNames lists the names of the Discord permission flags set in
+// perms, e.g. "Kick Members, Ban Members".
+func PermissionNames(perms int64) string {
+	var names []string
+	for _, p := range permissionNames {
+		if perms&p.flag == p.flag {
+			names = append(names, p.name)
+			perms &^= p.flag
+		}
+	}
+
+	if perms != 0 {
+		names = append(names, "Other")
+	}
+	return strings.Join(names, ", ")
+}
+
+// MemberPermissions returns the effective permissions of the user who sent the
+// message in the channel it was sent in, accounting for their roles and the
+// channel's overwrites.
+func (ctx *Context) MemberPermissions() (int64, error) {
+	/* Interactions come with the permissions already worked out */
+	if ctx.Interaction != nil && ctx.Interaction.Member != nil {
+		return ctx.Interaction.Member.Permissions, nil
+	}
+
+	member, err := ctx.Member()
+	if err != nil {
+		return 0, err
+	}
+	return ctx.channelPermissions(member)
+}
+
+// BotPermissions returns the effective permissions of the bot in the channel
+// the message was sent in.
+func (ctx *Context) BotPermissions() (int64, error) {
+	if ctx.Interaction != nil && ctx.Interaction.AppPermissions != 0 {
+		return ctx.Interaction.AppPermissions, nil
+	}
+
+	member, err := ctx.lookupMember(
+		ctx.Message.GuildID, ctx.Session.State.User.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return ctx.channelPermissions(member)
+}
+
+/* === Helper Functions === */
+
+// checkDiscordPermissions checks that both the member and the bot have the
+// Discord permissions required by the command. Returns the permissions the
+// member is missing and the permissions the bot is missing. Permissions are
+// not checked in DMs.
+func (ctx *Context) checkDiscordPermissions(
+	settings *CommandSettings,
+) (int64, int64, error) {
+	if ctx.Message.GuildID == "" {
+		return 0, 0, nil
+	}
+
+	var memberMissing, botMissing int64
+
+	if settings.MemberPermissions != 0 {
+		perms, err := ctx.MemberPermissions()
+		if err != nil {
+			return 0, 0, err
+		}
+		memberMissing = settings.MemberPermissions &^ perms
+	}
+
+	if settings.BotPermissions != 0 {
+		perms, err := ctx.BotPermissions()
+		if err != nil {
+			return 0, 0, err
+		}
+		botMissing = settings.BotPermissions &^ perms
+	}
+
+	return memberMissing, botMissing, nil
+}
+
+// channelPermissions computes the permissions of a member in the channel the
+// message was sent in. Threads have no overwrites of their own, so the
+// permissions of their parent channel are used. Guilds and channels are looked
+// up in the state first, falling back to the REST API.
+func (ctx *Context) channelPermissions(member *discordgo.Member) (int64, error) {
+	guild, err := ctx.Session.State.Guild(ctx.Message.GuildID)
+	if err != nil {
+		guild, err = ctx.Session.Guild(ctx.Message.GuildID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	channel, err := ctx.channel(ctx.Message.ChannelID)
+	if err != nil {
+		return 0, err
+	}
+
+	if channel.IsThread() {
+		channel, err = ctx.channel(channel.ParentID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	userID := ""
+	if member.User != nil {
+		userID = member.User.ID
+	}
+
+	return computePermissions(guild, channel, userID, member.Roles), nil
+}
+
+// channel looks up a channel in the state, falling back to the REST API.
+func (ctx *Context) channel(channelID string) (*discordgo.Channel, error) {
+	channel, err := ctx.Session.State.Channel(channelID)
+	if err != nil {
+		return ctx.Session.Channel(channelID)
+	}
+	return channel, nil
+}
+
+// computePermissions works out the permissions of a user with the given roles
+// in a channel, following the order Discord applies them in: the guild owner
+// and administrators have every permission, otherwise the permissions of
+// @everyone and the user's roles are combined before the channel's overwrites
+// for @everyone, the user's roles, and the user are applied in turn.
+func computePermissions(
+	guild *discordgo.Guild, channel *discordgo.Channel,
+	userID string, roleIDs []string,
+) int64 {
+	if guild.OwnerID == userID {
+		return allPermissions
+	}
+
+	hasRole := make(map[string]bool)
+	for _, id := range roleIDs {
+		hasRole[id] = true
+	}
+
+	var perms int64
+	for _, role := range guild.Roles {
+		if role.ID == guild.ID || hasRole[role.ID] {
+			perms |= role.Permissions
+		}
+	}
+
+	if perms&discordgo.PermissionAdministrator != 0 {
+		return allPermissions
+	}
+
+	/* @everyone overwrite */
+	for _, o := range channel.PermissionOverwrites {
+		if o.ID == guild.ID {
+			perms &^= o.Deny
+			perms |= o.Allow
+		}
+	}
+
+	/* Role overwrites are combined before being applied */
+	var allow, deny int64
+	for _, o := range channel.PermissionOverwrites {
+		if o.Type == discordgo.PermissionOverwriteTypeRole && hasRole[o.ID] {
+			allow |= o.Allow
+			deny |= o.Deny
+		}
+	}
+	perms &^= deny
+	perms |= allow
+
+	/* Member overwrite */
+	for _, o := range channel.PermissionOverwrites {
+		if o.Type == discordgo.PermissionOverwriteTypeMember && o.ID == userID {
+			perms &^= o.Deny
+			perms |= o.Allow
+		}
+	}
+
+	return perms
+}
@@ -0,0 +1,53 @@
+package multiplexer
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestThreadPermissions(t *testing.T) {
+	session, _ := discordgo.New("Bot token")
+	session.State.GuildAdd(&discordgo.Guild{
+		ID:      "guild",
+		OwnerID: "owner",
+		Roles: []*discordgo.Role{{
+			ID:          "guild",
+			Permissions: discordgo.PermissionSendMessages,
+		}},
+	})
+	session.State.ChannelAdd(&discordgo.Channel{
+		ID:      "announcements",
+		GuildID: "guild",
+		Type:    discordgo.ChannelTypeGuildText,
+		PermissionOverwrites: []*discordgo.PermissionOverwrite{{
+			ID:   "guild",
+			Type: discordgo.PermissionOverwriteTypeRole,
+			Deny: discordgo.PermissionSendMessages,
+		}},
+	})
+	session.State.ChannelAdd(&discordgo.Channel{
+		ID:       "thread",
+		GuildID:  "guild",
+		ParentID: "announcements",
+		Type:     discordgo.ChannelTypeGuildPublicThread,
+	})
+
+	member := &discordgo.Member{User: &discordgo.User{ID: "user"}}
+	for _, channel := range []string{"announcements", "thread"} {
+		ctx := &Context{
+			Session: session,
+			Message: &discordgo.MessageCreate{Message: &discordgo.Message{
+				ChannelID: channel, GuildID: "guild",
+			}},
+		}
+
+		perms, err := ctx.channelPermissions(member)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perms&discordgo.PermissionSendMessages != 0 {
+			t.Errorf("expected the overwrite of announcements to apply in %s", channel)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package multiplexer
+
+import (
+	"strings"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
+)
+
+// GuildSettings overlays the multiplexer's settings in a single guild.
+// Prefixes replace the global prefixes if there are any. SimpleCommands are
+// added to the global ones (replacing any with the same name, but never a
+// registered command), and Permissions replace the global permissions of the
+// same commands. Commands and simple commands named in Disabled can't be used
+// in the guild by anyone but the bot's owners.
+type GuildSettings struct {
+	Prefixes       []string
+	SimpleCommands []SimpleCommand
+	Permissions    map[string]*CommandPermissions
+	Disabled       []string
+}
+
+// SetGuilds replaces the settings of every guild, keyed by guild ID.
+func (m *Mux) SetGuilds(guilds map[string]*GuildSettings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setGuilds(guilds)
+}
+
+// SetGuild replaces the settings of a single guild. Passing nil removes them,
+// so the global settings are used.
+func (m *Mux) SetGuild(guildID string, settings *GuildSettings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	/* Copy, since the map may be shared with readers */
+	out := make(map[string]*GuildSettings, len(m.guilds)+1)
+	for id, g := range m.guilds {
+		out[id] = g
+	}
+
+	if settings == nil {
+		delete(out, guildID)
+	} else {
+		out[guildID] = settings
+	}
+	m.guilds = out
+}
+
+// Guild returns the settings of a guild, or nil if it has none of its own.
+func (m *Mux) Guild(guildID string) *GuildSettings {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.guilds[guildID]
+}
+
+// GuildSimpleCommands returns the simple commands usable in a guild (the
+// global ones plus the guild's own, minus any disabled), keyed by name.
+func (m *Mux) GuildSimpleCommands(guildID string) map[string]SimpleCommand {
+	out := m.SimpleCommands()
+	g := m.Guild(guildID)
+	if g == nil {
+		return out
+	}
+
+	for _, s := range g.SimpleCommands {
+		name := strings.ToLower(s.Command)
+		if !m.isCommand(name) {
+			out[name] = s
+		}
+	}
+
+	for name := range out {
+		if g.disabled(name) {
+			delete(out, name)
+		}
+	}
+	return out
+}
+
+// FindGuildSimple looks up a simple command by name or alias in a guild,
+// checking the guild's own simple commands before the global ones. Disabled
+// simple commands aren't found.
+func (m *Mux) FindGuildSimple(guildID, name string) (SimpleCommand, bool) {
+	s, disabled, ok := m.findGuildSimple(guildID, name)
+	if !ok || disabled {
+		return SimpleCommand{}, false
+	}
+	return s, true
+}
+
+/* === Helper Functions === */
+
+// setGuilds replaces the settings of every guild. The caller must hold the
+// lock.
+func (m *Mux) setGuilds(guilds map[string]*GuildSettings) {
+	out := make(map[string]*GuildSettings, len(guilds))
+	for id, g := range guilds {
+		if g != nil {
+			out[id] = g
+		}
+	}
+	m.guilds = out
+}
+
+// disabled checks if the command with the given path (or any of its parents)
+// is disabled in the guild.
+func (g *GuildSettings) disabled(command string) bool {
+	path := strings.Fields(strings.ToLower(command))
+	for i := range path {
+		if util.ArrayContains(g.Disabled, strings.Join(path[:i+1], " "), true) {
+			return true
+		}
+	}
+	return false
+}
+
+// findGuildSimple looks up a simple command in a guild like FindGuildSimple,
+// but also finds disabled simple commands (so the bot's owners can still use
+// them), reporting whether the command is disabled in the guild.
+func (m *Mux) findGuildSimple(
+	guildID, name string,
+) (SimpleCommand, bool, bool) {
+	name = strings.ToLower(name)
+	g := m.Guild(guildID)
+
+	/* Registered commands (and their aliases) take priority */
+	if g != nil && !m.isCommand(name) {
+		for _, s := range g.SimpleCommands {
+			if strings.EqualFold(s.Command, name) ||
+				util.ArrayContains(s.Aliases, name, true) {
+				return s, g.disabled(s.Command), true
+			}
+		}
+	}
+
+	s, ok := m.FindSimple(name)
+	if !ok {
+		return SimpleCommand{}, false, false
+	}
+	return s, g != nil && g.disabled(s.Command), true
+}
+
+// isCommand checks if the name or alias belongs to a registered command rather
+// than a simple command.
+func (m *Mux) isCommand(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if alias, ok := m.aliases[name]; ok {
+		name = alias
+	}
+	_, ok := m.commands[name]
+	return ok
+}
+
+// guildPermissions returns the permissions in use in a guild, with the
+// guild's own permissions replacing the global ones.
+func (m *Mux) guildPermissions(guildID string) map[string]*CommandPermissions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	g, ok := m.guilds[guildID]
+	if !ok || len(g.Permissions) == 0 {
+		return m.permissions
+	}
+
+	out := make(map[string]*CommandPermissions, len(m.permissions))
+	for k, v := range m.permissions {
+		out[k] = v
+	}
+	for k, v := range g.Permissions {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
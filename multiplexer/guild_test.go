@@ -0,0 +1,77 @@
+package multiplexer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// sentTransport answers like replyTransport, keeping the bodies of the
+// requests made.
+type sentTransport struct {
+	mu   *sync.Mutex
+	sent *[]string
+}
+
+func (s sentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	*s.sent = append(*s.sent, string(body))
+	s.mu.Unlock()
+	return replyTransport{}.RoundTrip(r)
+}
+
+func TestDisabledSimpleCommands(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+	session, _ := discordgo.New("Bot token")
+	session.State.User = &discordgo.User{ID: "app"}
+	session.Client = &http.Client{Transport: sentTransport{&mu, &sent}}
+
+	m, _ := New("!")
+	m.SetOwners("owner")
+	m.RegisterSimple(SimpleCommand{Command: "rules", Content: "Be nice"})
+	m.SetGuilds(map[string]*GuildSettings{
+		"guild": {
+			SimpleCommands: []SimpleCommand{{Command: "faq", Content: "Be nice"}},
+			Disabled:       []string{"rules", "faq"},
+		},
+	})
+	m.Initialize()
+
+	/* Sends the message, returning whether the simple command replied */
+	replied := func(userID, content string) bool {
+		mu.Lock()
+		sent = nil
+		mu.Unlock()
+
+		m.Handle(session, userMessage(userID, content))
+
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 1 && strings.Contains(sent[0], "Be nice")
+	}
+
+	for _, name := range []string{"rules", "faq"} {
+		if _, ok := m.FindGuildSimple("guild", name); ok {
+			t.Errorf("expected %s not to be found in the guild", name)
+		}
+		if replied("user", "!"+name) {
+			t.Errorf("expected %s not to reply to other users", name)
+		}
+		if !replied("owner", "!"+name) {
+			t.Errorf("expected %s to reply to the owner", name)
+		}
+	}
+
+	if _, ok := m.FindGuildSimple("other", "rules"); !ok {
+		t.Error("expected rules to be found in other guilds")
+	}
+}
@@ -0,0 +1,422 @@
+package multiplexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// interactionReply tracks how an interaction has been responded to so far,
+// since Discord only accepts a single initial response.
+type interactionReply struct {
+	sync.Mutex
+	responded, deferred bool
+}
+
+// PublishCommands publishes every registered command (along with its
+// subcommands and arguments) to Discord as a slash command. If guildID is
+// empty, the commands are published globally, which can take up to an hour to
+// show up. Replaces any slash commands previously published by the bot. Must be
+// called after the session is opened and after Mux.Register().
+func (m *Mux) PublishCommands(session *discordgo.Session, guildID string) error {
+	var commands []*discordgo.ApplicationCommand
+
+	for name, c := range m.Commands() {
+		ac, err := applicationCommand(name, c)
+		if err != nil {
+			return err
+		}
+		commands = append(commands, ac)
+	}
+
+	_, err := session.ApplicationCommandBulkOverwrite(
+		session.State.User.ID, guildID, commands,
+	)
+	return err
+}
+
+// HandleInteraction is passed to DiscordGo to handle slash commands. Commands
+// go through the same rate limiting, middlewares, permission checks and
+// argument parsing as they do when handled from a message.
+func (m *Mux) HandleInteraction(
+	session *discordgo.Session,
+	interaction *discordgo.InteractionCreate,
+) {
+	if interaction.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	muxOptions, errorTexts := m.current()
+
+	/* Ignore if the interaction is in a DM */
+	if muxOptions.IgnoreDMs && interaction.GuildID == "" {
+		return
+	}
+
+	/* Walk down the subcommands to find the options for the command itself */
+	data := interaction.ApplicationCommandData()
+	names := []string{data.Name}
+	options := data.Options
+	for len(options) == 1 &&
+		(options[0].Type == discordgo.ApplicationCommandOptionSubCommand ||
+			options[0].Type == discordgo.ApplicationCommandOptionSubCommandGroup) {
+		names = append(names, options[0].Name)
+		options = options[0].Options
+	}
+
+	/* Build a message from the interaction so commands can rely on it */
+	user := interaction.User
+	if interaction.Member != nil {
+		user = interaction.Member.User
+	}
+
+	values := optionValues(options)
+	var args []string
+	for _, o := range options {
+		args = append(args, values[o.Name])
+	}
+	raw := strings.Join(args, " ")
+
+	ctx := &Context{
+		Prefix:       "/",
+		Command:      strings.Join(names, " "),
+		Arguments:    args,
+		RawArguments: raw,
+		Session:      session,
+		Message: &discordgo.MessageCreate{
+			Message: &discordgo.Message{
+				ID:        interaction.ID,
+				ChannelID: interaction.ChannelID,
+				GuildID:   interaction.GuildID,
+				Author:    user,
+				Member:    interaction.Member,
+				Content:   "/" + strings.TrimSpace(strings.Join(names, " ")+" "+raw),
+				Type:      discordgo.MessageTypeDefault,
+			},
+		},
+		Interaction: interaction,
+		member:      interaction.Member,
+		members:     m.memberCache(),
+		store:       m.Storage(),
+		reply:       &interactionReply{},
+	}
+
+	handler, path, rest, ok := m.Find(names...)
+	if !ok || len(rest) != 0 {
+		ctx.ChannelSend(errorTexts.CommandNotFound)
+		return
+	}
+	ctx.Command = strings.Join(path, " ")
+
+	m.dispatch(ctx, handler, func(specs []Argument) (map[string][]interface{}, error) {
+		return parseOptions(specs, values)
+	})
+}
+
+// Defer acknowledges the command without replying yet, for commands which take
+// a while to respond. For slash commands, Discord shows a "thinking" message
+// until the next ChannelSend replaces it. For text commands, a typing
+// indicator is shown instead.
+func (ctx *Context) Defer() error {
+	if ctx.Interaction == nil {
+		return ctx.Session.ChannelTyping(ctx.Message.ChannelID)
+	}
+
+	ctx.reply.Lock()
+	defer ctx.reply.Unlock()
+
+	if ctx.reply.responded {
+		return nil
+	}
+
+	err := ctx.Session.InteractionRespond(
+		ctx.Interaction.Interaction,
+		&discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx.reply.responded = true
+	ctx.reply.deferred = true
+	return nil
+}
+
+// respond replies to the interaction. The first reply is sent as the
+// interaction response (replacing the "thinking" message if it was deferred),
+// and any after that are sent as follow-up messages. Discord doesn't return
+// the message sent as the interaction response, so nil is returned for it
+// rather than making another request to fetch it.
+func (ctx *Context) respond(message string) (*discordgo.Message, error) {
+	ctx.reply.Lock()
+	defer ctx.reply.Unlock()
+
+	i := ctx.Interaction.Interaction
+
+	switch {
+	case !ctx.reply.responded:
+		err := ctx.Session.InteractionRespond(i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Content: message},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ctx.reply.responded = true
+		return nil, nil
+
+	case ctx.reply.deferred:
+		ctx.reply.deferred = false
+		return ctx.Session.InteractionResponseEdit(
+			i, &discordgo.WebhookEdit{Content: &message},
+		)
+
+	default:
+		return ctx.Session.FollowupMessageCreate(
+			i, true, &discordgo.WebhookParams{Content: message},
+		)
+	}
+}
+
+/* === Helper Functions === */
+
+// applicationCommand converts a command into its slash command definition.
+// Discord only allows two levels of subcommands below the command itself, and
+// commands with subcommands can't take arguments of their own.
+func applicationCommand(
+	name string, c Command,
+) (*discordgo.ApplicationCommand, error) {
+	settings := c.Settings()
+	lower, err := optionName(name, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ac := &discordgo.ApplicationCommand{
+		Name:        lower,
+		Description: description(settings.HelpText),
+	}
+
+	if len(settings.Subcommands) == 0 {
+		ac.Options, err = argumentOptions(name, settings.Arguments)
+		return ac, err
+	}
+	if len(settings.Arguments) > 0 {
+		return nil, argumentsAndSubcommands(name)
+	}
+
+	for _, child := range settings.Subcommands {
+		opt, err := subcommandOption(name, child, true)
+		if err != nil {
+			return nil, err
+		}
+		ac.Options = append(ac.Options, opt)
+	}
+
+	return ac, nil
+}
+
+// subcommandOption converts a subcommand into a slash command option. Only
+// subcommands directly below the command (where group is set) can have
+// subcommands of their own.
+func subcommandOption(
+	parent string, c Command, group bool,
+) (*discordgo.ApplicationCommandOption, error) {
+	cs := c.Settings()
+	path := parent + " " + cs.Command
+
+	name, err := optionName(path, cs.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        name,
+		Description: description(cs.HelpText),
+	}
+
+	if len(cs.Subcommands) == 0 {
+		opt.Options, err = argumentOptions(path, cs.Arguments)
+		return opt, err
+	}
+
+	if !group {
+		return nil, fmt.Errorf(
+			"command %q is nested too deeply to be a slash command", path,
+		)
+	}
+	if len(cs.Arguments) > 0 {
+		return nil, argumentsAndSubcommands(path)
+	}
+
+	opt.Type = discordgo.ApplicationCommandOptionSubCommandGroup
+	for _, grandchild := range cs.Subcommands {
+		o, err := subcommandOption(path, grandchild, false)
+		if err != nil {
+			return nil, err
+		}
+		opt.Options = append(opt.Options, o)
+	}
+
+	return opt, nil
+}
+
+// argumentsAndSubcommands is the error for a command which has both arguments
+// and subcommands, since slash commands can't have both.
+func argumentsAndSubcommands(path string) error {
+	return fmt.Errorf(
+		"command %q has both arguments and subcommands, which slash commands "+
+			"can't have", path,
+	)
+}
+
+// optionName lowercases the name of a command or argument for use in a slash
+// command, checking it's 1-32 letters, numbers, dashes or underscores as
+// Discord requires. The path describes where the name came from in errors.
+func optionName(path, name string) (string, error) {
+	name = strings.ToLower(name)
+
+	if n := utf8.RuneCountInString(name); n < 1 || n > 32 {
+		return "", fmt.Errorf(
+			"%q can't be used in a slash command, names must be 1-32 "+
+				"characters long", path,
+		)
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '-' && r != '_' {
+			return "", fmt.Errorf(
+				"%q can't be used in a slash command, names can only contain "+
+					"letters, numbers, dashes and underscores", path,
+			)
+		}
+	}
+
+	return name, nil
+}
+
+// argumentOptions converts the argument specification of the command at path
+// into slash command options. Variadic arguments become a single text option.
+func argumentOptions(
+	path string, specs []Argument,
+) ([]*discordgo.ApplicationCommandOption, error) {
+	var options []*discordgo.ApplicationCommandOption
+
+	for _, a := range specs {
+		name, err := optionName(path+" <"+a.Name+">", a.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		t := discordgo.ApplicationCommandOptionString
+		if !a.Variadic {
+			switch a.Type {
+			case ArgInt:
+				t = discordgo.ApplicationCommandOptionInteger
+			case ArgBool:
+				t = discordgo.ApplicationCommandOptionBoolean
+			case ArgUser:
+				t = discordgo.ApplicationCommandOptionUser
+			case ArgChannel:
+				t = discordgo.ApplicationCommandOptionChannel
+			case ArgRole:
+				t = discordgo.ApplicationCommandOptionRole
+			}
+		}
+
+		help := a.HelpText
+		if len(help) == 0 {
+			help = a.Type.String()
+		}
+
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:        t,
+			Name:        name,
+			Description: description(help),
+			Required:    a.Required,
+		})
+	}
+
+	return options, nil
+}
+
+// parseOptions converts the options of a slash command into arguments using
+// the argument specification. Unlike text commands, options are matched by
+// name rather than position.
+func parseOptions(
+	specs []Argument, values map[string]string,
+) (map[string][]interface{}, error) {
+	out := make(map[string][]interface{})
+
+	for s := range specs {
+		spec := &specs[s]
+
+		value, ok := values[strings.ToLower(spec.Name)]
+		if !ok {
+			if spec.Required {
+				return out, &ArgumentError{spec, "missing required argument"}
+			}
+			if len(spec.Default) == 0 {
+				continue
+			}
+			value = spec.Default
+		}
+
+		/* Variadic arguments arrive as one string, so split them up */
+		args := []string{value}
+		if spec.Variadic {
+			args = Tokenize(value)
+		}
+
+		for _, arg := range args {
+			v, err := parseArgument(spec, arg)
+			if err != nil {
+				return out, err
+			}
+			out[spec.Name] = append(out[spec.Name], v)
+		}
+	}
+
+	return out, nil
+}
+
+// optionValues converts the values of slash command options to strings keyed
+// by option name, as if they were typed as text arguments.
+func optionValues(
+	options []*discordgo.ApplicationCommandInteractionDataOption,
+) map[string]string {
+	out := make(map[string]string)
+
+	for _, o := range options {
+		switch v := o.Value.(type) {
+		case float64:
+			out[o.Name] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			out[o.Name] = fmt.Sprint(v)
+		}
+	}
+
+	return out
+}
+
+// description fits help text into the 1-100 characters Discord allows for
+// slash command descriptions.
+func description(text string) string {
+	if len(text) == 0 {
+		return "No description"
+	}
+
+	if r := []rune(text); len(r) > 100 {
+		return string(r[:97]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,459 @@
+package multiplexer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// testCommand is a command whose settings and handler are supplied by a test.
+type testCommand struct {
+	settings *CommandSettings
+	handle   func(*Context)
+}
+
+func (c testCommand) Init(m *Mux)                {}
+func (c testCommand) HandleHelp(ctx *Context)    {}
+func (c testCommand) Settings() *CommandSettings { return c.settings }
+func (c testCommand) Handle(ctx *Context) {
+	if c.handle != nil {
+		c.handle(ctx)
+	}
+}
+
+// fakeRequest is a request received by the fake Discord API.
+type fakeRequest struct {
+	Method, Path string
+	Body         map[string]interface{}
+	List         []interface{}
+}
+
+// fakeDiscord stands in for Discord's REST API, recording every request.
+type fakeDiscord struct {
+	mu       sync.Mutex
+	requests []fakeRequest
+}
+
+// newFakeDiscord starts a fake Discord API and points discordgo at it until
+// the test finishes.
+func newFakeDiscord(t *testing.T) (*fakeDiscord, *discordgo.Session) {
+	f := &fakeDiscord{}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+
+	endpoints := []*string{
+		&discordgo.EndpointDiscord, &discordgo.EndpointAPI,
+		&discordgo.EndpointChannels, &discordgo.EndpointWebhooks,
+		&discordgo.EndpointApplications,
+	}
+	old := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		old[i] = *e
+	}
+
+	discordgo.EndpointDiscord = srv.URL + "/"
+	discordgo.EndpointAPI = discordgo.EndpointDiscord + "api/v" +
+		discordgo.APIVersion + "/"
+	discordgo.EndpointChannels = discordgo.EndpointAPI + "channels/"
+	discordgo.EndpointWebhooks = discordgo.EndpointAPI + "webhooks/"
+	discordgo.EndpointApplications = discordgo.EndpointAPI + "applications"
+
+	t.Cleanup(func() {
+		srv.Close()
+		for i, e := range endpoints {
+			*e = old[i]
+		}
+	})
+
+	session, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.State.User = &discordgo.User{ID: "app"}
+	return f, session
+}
+
+func (f *fakeDiscord) serve(w http.ResponseWriter, r *http.Request) {
+	req := fakeRequest{
+		Method: r.Method,
+		Path: strings.TrimPrefix(
+			r.URL.Path, "/api/v"+discordgo.APIVersion,
+		),
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if len(body) > 0 {
+		if body[0] == '[' {
+			json.Unmarshal(body, &req.List)
+		} else {
+			json.Unmarshal(body, &req.Body)
+		}
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(req.Path, "/callback"):
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(req.Path, "/commands"):
+		w.Write(body)
+	default:
+		w.Write([]byte(`{"id": "message"}`))
+	}
+}
+
+// get returns every request received so far.
+func (f *fakeDiscord) get() []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]fakeRequest(nil), f.requests...)
+}
+
+// slashInteraction builds an interaction for a slash command used in a guild.
+func slashInteraction(
+	name string, options ...*discordgo.ApplicationCommandInteractionDataOption,
+) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        "interaction",
+		AppID:     "app",
+		Type:      discordgo.InteractionApplicationCommand,
+		Token:     "token",
+		GuildID:   "guild",
+		ChannelID: "channel",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: "user"}},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name:    name,
+			Options: options,
+		},
+	}}
+}
+
+// waitFor waits for a handler to finish.
+func waitFor(t *testing.T, done chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler wasn't called")
+	}
+}
+
+func TestPublishCommands(t *testing.T) {
+	fake, session := newFakeDiscord(t)
+
+	m, _ := New("!")
+	err := m.Register(
+		testCommand{settings: &CommandSettings{
+			Command:  "remind",
+			HelpText: "Sets a reminder",
+			Arguments: []Argument{
+				{Name: "when", Type: ArgDuration, Required: true},
+				{Name: "message", Variadic: true},
+			},
+		}},
+		CommandGroup{Command: "role", HelpText: "Manages roles", Subcommands: []Command{
+			testCommand{settings: &CommandSettings{
+				Command:   "add",
+				Arguments: []Argument{{Name: "user", Type: ArgUser, Required: true}},
+			}},
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.PublishCommands(session, "guild"); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := fake.get()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	if reqs[0].Method != http.MethodPut ||
+		reqs[0].Path != "/applications/app/guilds/guild/commands" {
+		t.Fatalf("unexpected request %s %s", reqs[0].Method, reqs[0].Path)
+	}
+
+	commands := make(map[string]map[string]interface{})
+	for _, c := range reqs[0].List {
+		c := c.(map[string]interface{})
+		commands[c["name"].(string)] = c
+	}
+
+	remind := commands["remind"]["options"].([]interface{})
+	if len(remind) != 2 {
+		t.Fatalf("expected 2 options for remind, got %d", len(remind))
+	}
+	when := remind[0].(map[string]interface{})
+	if when["name"] != "when" || when["required"] != true ||
+		when["type"] != float64(discordgo.ApplicationCommandOptionString) {
+		t.Errorf("unexpected option %v", when)
+	}
+
+	add := commands["role"]["options"].([]interface{})[0].(map[string]interface{})
+	if add["name"] != "add" ||
+		add["type"] != float64(discordgo.ApplicationCommandOptionSubCommand) {
+		t.Errorf("unexpected subcommand %v", add)
+	}
+	user := add["options"].([]interface{})[0].(map[string]interface{})
+	if user["type"] != float64(discordgo.ApplicationCommandOptionUser) {
+		t.Errorf("unexpected option %v", user)
+	}
+}
+
+func TestApplicationCommandProblems(t *testing.T) {
+	leaf := func(name string, args ...Argument) Command {
+		return testCommand{settings: &CommandSettings{
+			Command: name, Arguments: args,
+		}}
+	}
+	group := func(name string, args []Argument, children ...Command) Command {
+		return testCommand{settings: &CommandSettings{
+			Command: name, Arguments: args, Subcommands: children,
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		command Command
+		problem string
+	}{
+		{
+			name:    "valid",
+			command: group("Role", nil, group("Colour", nil, leaf("set-hex", Argument{Name: "Hex_2"}))),
+		},
+		{
+			name:    "arguments and subcommands",
+			command: group("role", []Argument{{Name: "user"}}, leaf("add")),
+			problem: `"role" has both arguments and subcommands`,
+		},
+		{
+			name:    "group with arguments",
+			command: group("role", nil, group("colour", []Argument{{Name: "hex"}}, leaf("set"))),
+			problem: `"role colour" has both arguments and subcommands`,
+		},
+		{
+			name:    "nested too deeply",
+			command: group("a", nil, group("b", nil, group("c", nil, leaf("d")))),
+			problem: `"a b c" is nested too deeply`,
+		},
+		{
+			name:    "name too long",
+			command: leaf(strings.Repeat("a", 33)),
+			problem: "must be 1-32 characters long",
+		},
+		{
+			name:    "empty argument name",
+			command: leaf("remind", Argument{}),
+			problem: `"remind <>" can't be used`,
+		},
+		{
+			name:    "argument name with spaces",
+			command: leaf("remind", Argument{Name: "when to"}),
+			problem: "can only contain letters, numbers, dashes and underscores",
+		},
+		{
+			name:    "subcommand name with symbols",
+			command: group("role", nil, leaf("add!")),
+			problem: `"role add!" can't be used`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tt.command.Settings().Command
+			ac, err := applicationCommand(name, tt.command)
+			if len(tt.problem) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				sub := ac.Options[0].Options[0]
+				if ac.Name != "role" || sub.Name != "set-hex" || sub.Options[0].Name != "hex_2" {
+					t.Errorf("expected the names to be lower case, got %q %q %q",
+						ac.Name, sub.Name, sub.Options[0].Name)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("expected %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestHandleInteractionRouting(t *testing.T) {
+	_, session := newFakeDiscord(t)
+
+	done := make(chan struct{})
+	var (
+		command string
+		userID  string
+		reason  string
+	)
+
+	m, _ := New("!")
+	m.Register(CommandGroup{Command: "role", Subcommands: []Command{
+		testCommand{
+			settings: &CommandSettings{
+				Command: "add",
+				Arguments: []Argument{
+					{Name: "user", Type: ArgUser, Required: true},
+					{Name: "reason", Variadic: true},
+				},
+			},
+			handle: func(ctx *Context) {
+				command, userID = ctx.Command, ctx.User("user")
+				reason = strings.Join(stringList(ctx.List("reason")), " ")
+				close(done)
+			},
+		},
+	}})
+	m.Initialize()
+
+	m.HandleInteraction(session, slashInteraction("role",
+		&discordgo.ApplicationCommandInteractionDataOption{
+			Name: "add",
+			Type: discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "user", Type: discordgo.ApplicationCommandOptionUser, Value: "42"},
+				{Name: "reason", Type: discordgo.ApplicationCommandOptionString, Value: "being nice"},
+			},
+		},
+	))
+	waitFor(t, done)
+
+	if command != "role add" {
+		t.Errorf("expected command %q, got %q", "role add", command)
+	}
+	if userID != "42" {
+		t.Errorf("expected user %q, got %q", "42", userID)
+	}
+	if reason != "being nice" {
+		t.Errorf("expected reason %q, got %q", "being nice", reason)
+	}
+}
+
+func TestHandleInteractionUnknownCommand(t *testing.T) {
+	fake, session := newFakeDiscord(t)
+
+	m, _ := New("!")
+	m.Initialize()
+	m.HandleInteraction(session, slashInteraction("missing"))
+
+	reqs := fake.get()
+	if len(reqs) == 0 || !strings.HasSuffix(reqs[0].Path, "/callback") {
+		t.Fatalf("expected an interaction response, got %v", reqs)
+	}
+	data := reqs[0].Body["data"].(map[string]interface{})
+	if data["content"] != "Command not found." {
+		t.Errorf("unexpected reply %v", data["content"])
+	}
+}
+
+func TestInteractionReplies(t *testing.T) {
+	tests := []struct {
+		name     string
+		deferred bool
+		expected []string
+	}{
+		{
+			name: "respond then follow up",
+			expected: []string{
+				"POST /interactions/interaction/token/callback",
+				"POST /webhooks/app/token",
+			},
+		},
+		{
+			name:     "defer then edit and follow up",
+			deferred: true,
+			expected: []string{
+				"POST /interactions/interaction/token/callback",
+				"PATCH /webhooks/app/token/messages/@original",
+				"POST /webhooks/app/token",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, session := newFakeDiscord(t)
+
+			done := make(chan struct{})
+			m, _ := New("!")
+			m.Register(testCommand{
+				settings: &CommandSettings{Command: "ping"},
+				handle: func(ctx *Context) {
+					defer close(done)
+					if tt.deferred {
+						if err := ctx.Defer(); err != nil {
+							t.Error(err)
+						}
+						/* Deferring twice does nothing */
+						ctx.Defer()
+					}
+					if _, err := ctx.ChannelSend("first"); err != nil {
+						t.Error(err)
+					}
+					if _, err := ctx.ChannelSend("second"); err != nil {
+						t.Error(err)
+					}
+				},
+			})
+			m.Initialize()
+
+			m.HandleInteraction(session, slashInteraction("ping"))
+			waitFor(t, done)
+
+			reqs := fake.get()
+			var got []string
+			for _, r := range reqs {
+				got = append(got, r.Method+" "+r.Path)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Fatalf("expected requests:\n%s\ngot:\n%s",
+					strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+
+			callback := reqs[0].Body
+			wantType := discordgo.InteractionResponseChannelMessageWithSource
+			if tt.deferred {
+				wantType = discordgo.InteractionResponseDeferredChannelMessageWithSource
+			}
+			if callback["type"] != float64(wantType) {
+				t.Errorf("expected response type %d, got %v", wantType, callback["type"])
+			}
+
+			if tt.deferred {
+				if reqs[1].Body["content"] != "first" {
+					t.Errorf("expected the edit to send %q, got %v", "first", reqs[1].Body)
+				}
+			} else {
+				data := callback["data"].(map[string]interface{})
+				if data["content"] != "first" {
+					t.Errorf("expected the response to send %q, got %v", "first", data)
+				}
+			}
+			followUp := reqs[len(reqs)-1].Body
+			if followUp["content"] != "second" {
+				t.Errorf("expected the follow-up to send %q, got %v", "second", followUp)
+			}
+		})
+	}
+}
+
+// stringList converts the values of a variadic string argument.
+func stringList(values []interface{}) []string {
+	var out []string
+	for _, v := range values {
+		out = append(out, v.(string))
+	}
+	return out
+}
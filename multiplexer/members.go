@@ -0,0 +1,106 @@
+package multiplexer
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/patrickmn/go-cache"
+)
+
+// DefaultMemberCacheTTL is how long guild members fetched from Discord are
+// cached for by default.
+const DefaultMemberCacheTTL = 5 * time.Minute
+
+// SetMemberCacheTTL sets how long guild members fetched from Discord are cached
+// for, clearing the cache. A TTL of zero or less disables caching.
+func (m *Mux) SetMemberCacheTTL(ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ttl <= 0 {
+		m.members = nil
+		return
+	}
+	m.members = cache.New(ttl, 2*ttl)
+}
+
+// ForgetMember removes a guild member from the cache, so the next lookup
+// fetches them again (e.g. after their roles change).
+func (m *Mux) ForgetMember(guildID, userID string) {
+	if members := m.memberCache(); members != nil {
+		members.Delete(memberKey(guildID, userID))
+	}
+}
+
+// Member returns the guild member who sent the message. The member is taken
+// from the message itself or the session's state if possible, then from the
+// multiplexer's cache, and only fetched from Discord as a last resort. The
+// member is only looked up once per context.
+func (ctx *Context) Member() (*discordgo.Member, error) {
+	if ctx.member != nil {
+		return ctx.member, nil
+	}
+
+	guildID, author := ctx.Message.GuildID, ctx.Message.Author
+
+	var member *discordgo.Member
+	if ctx.Message.Member != nil {
+		/* Members attached to messages don't include the user */
+		m := *ctx.Message.Member
+		m.GuildID = guildID
+		m.User = author
+		member = &m
+	} else {
+		var err error
+		member, err = ctx.lookupMember(guildID, author.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx.member = member
+	return member, nil
+}
+
+/* === Helper Functions === */
+
+// memberCache returns the cache of guild members, or nil if caching is
+// disabled.
+func (m *Mux) memberCache() *cache.Cache {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.members
+}
+
+// lookupMember finds a guild member in the session's state, then the
+// multiplexer's cache, before fetching (and caching) them from Discord.
+func (ctx *Context) lookupMember(
+	guildID, userID string,
+) (*discordgo.Member, error) {
+	if member, err := ctx.Session.State.Member(guildID, userID); err == nil {
+		return member, nil
+	}
+
+	key := memberKey(guildID, userID)
+	if ctx.members != nil {
+		if v, ok := ctx.members.Get(key); ok {
+			return v.(*discordgo.Member), nil
+		}
+	}
+
+	member, err := ctx.Session.GuildMember(guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.members != nil {
+		ctx.members.SetDefault(key, member)
+	}
+	return member, nil
+}
+
+// memberKey returns the key a guild member is cached under.
+func memberKey(guildID, userID string) string {
+	return guildID + ":" + userID
+}
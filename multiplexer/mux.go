@@ -1,28 +1,50 @@
 package multiplexer
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/storage"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/patrickmn/go-cache"
 	"github.com/sahilm/fuzzy"
+	"github.com/sirupsen/logrus"
 )
 
+// DefaultPermissions is the key of the permissions applied to any command
+// without permissions of its own.
+const DefaultPermissions = "*"
+
 type (
-	// Mux is the multiplexer object. Initialized with New().
+	// Mux is the multiplexer object. Initialized with New(). All of its methods
+	// are safe to call while messages are being handled.
 	Mux struct {
-		Prefix         string
-		Commands       map[string]Command
-		SimpleCommands map[string]SimpleCommand
-		Middleware     []Middleware
+		Prefix   string
+		Prefixes []string
+
+		/* Guards everything below, all of which can be changed at runtime */
+		mu             sync.RWMutex
+		commands       map[string]Command
+		simpleCommands map[string]SimpleCommand
+		middleware     []Middleware
 		options        *Options
 		fuzzyMatch     bool
-		commandNames   []string
 		errorTexts     *ErrorTexts
 		permissions    map[string]*CommandPermissions
+		aliases        map[string]string
+		prefixResolver PrefixResolver
+		initialized    bool
+		logger         logrus.FieldLogger
+		owners         []string
+		members        *cache.Cache
+		warned         *cache.Cache
+		rateLimits     map[string]*specLimiter
+		store          storage.Store
+		guilds         map[string]*GuildSettings
 	}
 
 	// Command specifies the functions for a multiplexed command
@@ -33,146 +55,431 @@ type (
 		Settings() *CommandSettings
 	}
 
-	// CommandPermissions holds the specific ID arrays for a given command in whitelist
-	// format. UserID takes priority over all other permissions. RoleID takes
-	// priority over ChanID.
-	CommandPermissions struct {
-		UserIDs []string
-		RoleIDs []string
-		ChanIDs []string
-	}
-
 	// CommandSettings contain command-specific settings the multiplexer should
 	// know.
 	CommandSettings struct {
 		Command, HelpText string
+		Aliases           []string
+
+		/* Category is used to group commands in help listings */
+		Category string
+
+		/* Arguments are parsed and validated before the command is handled */
+		Arguments []Argument
+
+		/* Subcommands are routed to when their name follows this command's */
+		Subcommands []Command
+
+		/* Discord permission flags (e.g. discordgo.PermissionKickMembers) the
+		   member calling the command and the bot itself need in the channel */
+		MemberPermissions int64
+		BotPermissions    int64
 
+		/* Only allow the bot's owners to use the command */
+		OwnerOnly bool
+
+		/* Limits how often the command can be used */
+		RateLimiter RateLimiter
+
+		/* Deprecated: use RateLimiter. Allows each user RateLimitMax uses
+		   until their entry in RateLimitDB expires */
 		RateLimitMax int
 		RateLimitDB  *cache.Cache
 	}
 
 	// SimpleCommand contains the content and helptext of a logic-less command.
-	// Simple commands have no support for permissions.
+	// Simple commands have no support for permissions. If Responses are set,
+	// one of them is sent at random in place of Content, and Embed is sent
+	// along with the content. If Template is set, the content and the text of
+	// the embed are text/template templates executed with SimpleData.
 	SimpleCommand struct {
 		Command, Content, HelpText string
+		Aliases                    []string
+
+		Responses []string
+		Embed     *discordgo.MessageEmbed
+		Template  bool
 	}
 
-	// ErrorTexts holds strings used when an error occurs
+	// ErrorTexts holds strings used when an error occurs.
+	// MemberMissingPermissions and BotMissingPermissions are formatted with the
+	// names of the missing Discord permissions, and RateLimited with how long
+	// until the command can be used again (e.g. "1 minute 30 seconds").
+	// InternalError is sent when something goes wrong while checking a command
+	// (e.g. Discord can't be reached), with the actual error going to the
+	// logger.
 	ErrorTexts struct {
-		CommandNotFound, NoPermissions, RateLimited string
+		CommandNotFound, NoPermissions, RateLimited, InvalidArguments string
+		MemberMissingPermissions, BotMissingPermissions               string
+		InternalError                                                 string
 	}
 
-	// Context is the contexual values supplied to middlewares and handlers
+	// Context is the contexual values supplied to middlewares and handlers.
+	// For subcommands, Command holds the full path of the command (e.g.
+	// "role add") and Arguments only contains what follows it. For slash
+	// commands, Interaction is set and Message is built from it so commands
+	// can treat both the same way.
 	Context struct {
 		Prefix, Command string
 		Arguments       []string
+		RawArguments    string
 		Session         *discordgo.Session
 		Message         *discordgo.MessageCreate
+		Interaction     *discordgo.InteractionCreate
+
+		parsed  map[string][]interface{}
+		member  *discordgo.Member
+		members *cache.Cache
+		store   storage.Store
+		reply   *interactionReply
+		tier    *Tier
 	}
 
 	// Middleware specifies a special middleware function that is called anytime
 	// handle() is called from DiscordGo
 	Middleware func(*Context)
 
-	// Options is a set of config options to use when handling a message. All
-	// properties true by default.
+	// Options is a set of config options to use when handling a message. New
+	// enables IgnoreBots, IgnoreDMs, IgnoreEmpty, IgnoreNonDefault,
+	// MentionPrefix and AdminOverride, leaving ExplainPermissions off and
+	// RateLimitReaction empty.
 	Options struct {
 		IgnoreBots       bool
 		IgnoreDMs        bool
 		IgnoreEmpty      bool
 		IgnoreNonDefault bool
+
+		/* Allow mentioning the bot (e.g. "@Bot help") in place of a prefix */
+		MentionPrefix bool
+
+		/* Explain which permission rule denied a command in the reply */
+		ExplainPermissions bool
+
+		/* Let members with the Administrator permission bypass permission
+		   rules and rate limits, like the bot's owners */
+		AdminOverride bool
+
+		/* React to rate limited messages with this emoji instead of replying */
+		RateLimitReaction string
+	}
+
+	// Config holds the settings which are usually loaded from a config file,
+	// so they can all be swapped in at once with SetConfig.
+	Config struct {
+		Owners         []string
+		SimpleCommands []SimpleCommand
+		Permissions    map[string]*CommandPermissions
+		RateLimits     *RateLimits
+		Guilds         map[string]*GuildSettings
 	}
 )
 
-// New initlaizes a new Mux object
-func New(prefix string) (*Mux, error) {
-	if len(prefix) > 1 {
-		return &Mux{}, fmt.Errorf("prefix %s greater than 1 character", prefix)
+// New initlaizes a new Mux object. Accepts one or more prefixes of any length,
+// the first of which is the default used in help and usage messages.
+func New(prefixes ...string) (*Mux, error) {
+	if len(prefixes) == 0 {
+		return &Mux{}, fmt.Errorf("at least one prefix is required")
+	}
+
+	for _, p := range prefixes {
+		if len(strings.TrimSpace(p)) == 0 {
+			return &Mux{}, fmt.Errorf("prefix %q is empty", p)
+		}
 	}
 
 	return &Mux{
-		Prefix:         prefix,
-		Commands:       make(map[string]Command),
-		SimpleCommands: make(map[string]SimpleCommand),
-		Middleware:     []Middleware{},
+		Prefix:         prefixes[0],
+		Prefixes:       prefixes,
+		commands:       make(map[string]Command),
+		simpleCommands: make(map[string]SimpleCommand),
+		middleware:     []Middleware{},
 		errorTexts: &ErrorTexts{
-			CommandNotFound: "Command not found.",
-			NoPermissions:   "You do not have permission to use that command.",
+			CommandNotFound:  "Command not found.",
+			NoPermissions:    "You do not have permission to use that command.",
+			RateLimited:      "You're using that command too often, try again in %s.",
+			InvalidArguments: "Invalid arguments.",
+
+			MemberMissingPermissions: "You need these permissions to use that command: %s",
+			BotMissingPermissions:    "I need these permissions to do that: %s",
+
+			InternalError: "Something went wrong, try again later.",
+		},
+		options: &Options{
+			IgnoreBots:       true,
+			IgnoreDMs:        true,
+			IgnoreEmpty:      true,
+			IgnoreNonDefault: true,
+			MentionPrefix:    true,
+			AdminOverride:    true,
 		},
-		options:     &Options{true, true, true, true},
 		permissions: make(map[string]*CommandPermissions),
+		aliases:     make(map[string]string),
 		fuzzyMatch:  false,
+		members:     cache.New(DefaultMemberCacheTTL, 2*DefaultMemberCacheTTL),
+		warned:      cache.New(defaultWarningCooldown, time.Minute),
 	}, nil
 }
 
-// SetOptions allows configuration of the multiplexer. Must be called before
-// Initialize()
+// SetOptions allows configuration of the multiplexer.
 func (m *Mux) SetOptions(opt *Options) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.options = opt
 }
 
-// SetPermissions allows defining permissions for each command. Must be called
-// before Initialize()
+// SetPermissions allows defining permissions for each command.
 func (m *Mux) SetPermissions(perms map[string]*CommandPermissions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.permissions = perms
 }
 
 // UseMiddleware adds a middleware to the multiplexer. Middlewares are called
-// before a command is handled.
+// alongside the command once it has passed the rate limits, permission checks
+// and argument parsing, each with its own copy of the context.
 func (m *Mux) UseMiddleware(mw Middleware) {
-	m.Middleware = append(m.Middleware, mw)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.middleware = append(m.middleware, mw)
+}
+
+// SetLogger sets the logger the multiplexer reports problems and permission
+// decisions to. Nothing is logged if no logger is set.
+func (m *Mux) SetLogger(logger logrus.FieldLogger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.logger = logger
+}
+
+// SetStorage sets the store commands can use to keep data between restarts.
+func (m *Mux) SetStorage(store storage.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.store = store
+}
+
+// Storage returns the store commands can use to keep data between restarts,
+// or nil if none has been set.
+func (m *Mux) Storage() storage.Store {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.store
 }
 
 // SetErrors sets the error texts for the multiplexer using the supplied struct
 func (m *Mux) SetErrors(errorTexts *ErrorTexts) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.errorTexts = errorTexts
 }
 
-// Register registers one or more commands to the multiplexer
-func (m *Mux) Register(commands ...Command) {
+// Register registers one or more commands to the multiplexer. If the name or
+// an alias of a command is already taken by another command, simple command or
+// alias, the conflicting name is skipped and an error listing every collision
+// is returned once the rest have been registered. Commands whose argument
+// specifications (or those of their subcommands) are invalid aren't registered,
+// and are listed in the error too. Commands registered after Initialize() are
+// initialized straight away.
+func (m *Mux) Register(commands ...Command) error {
+	var (
+		errs, invalid []string
+		added         []Command
+	)
+
+	m.mu.Lock()
+
 	for _, c := range commands {
-		cString := c.Settings().Command
-		if len(cString) != 0 {
-			m.Commands[cString] = c
+		settings := c.Settings()
+		name := strings.ToLower(settings.Command)
+		if len(name) == 0 {
+			continue
+		}
+
+		/* Commands whose arguments can't be parsed would only fail at runtime */
+		if problems := checkTree(name, c); len(problems) > 0 {
+			invalid = append(invalid, problems...)
+			continue
 		}
+
+		if err := m.checkName(name); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		m.commands[name] = c
+		added = append(added, c)
+
+		errs = append(errs, m.registerAliases(name, settings.Aliases)...)
 	}
+	initialized := m.initialized
+	m.mu.Unlock()
+
+	/* Init is called without the lock held, since commands may call back into
+	   the multiplexer */
+	if initialized {
+		for _, c := range added {
+			initTree(m, c)
+		}
+	}
+
+	return registerError(errs, invalid)
 }
 
-// RegisterSimple registers one or more simple commands to the multiplexer
-func (m *Mux) RegisterSimple(simpleCommands ...SimpleCommand) {
-	for _, c := range simpleCommands {
-		cString := c.Command
-		if len(cString) != 0 {
-			m.SimpleCommands[cString] = c
+// Unregister removes one or more commands (and their aliases) from the
+// multiplexer by name.
+func (m *Mux) Unregister(names ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if _, ok := m.commands[name]; !ok {
+			continue
+		}
+		delete(m.commands, name)
+
+		for alias, owner := range m.aliases {
+			if owner == name {
+				delete(m.aliases, alias)
+			}
 		}
 	}
 }
 
+// Commands returns a copy of the registered commands, keyed by name.
+func (m *Mux) Commands() map[string]Command {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make(map[string]Command, len(m.commands))
+	for k, v := range m.commands {
+		out[k] = v
+	}
+	return out
+}
+
+// SimpleCommands returns a copy of the registered simple commands, keyed by
+// name.
+func (m *Mux) SimpleCommands() map[string]SimpleCommand {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make(map[string]SimpleCommand, len(m.simpleCommands))
+	for k, v := range m.simpleCommands {
+		out[k] = v
+	}
+	return out
+}
+
+// RegisterSimple registers one or more simple commands to the multiplexer.
+// Name collisions are handled the same way as in Register.
+func (m *Mux) RegisterSimple(simpleCommands ...SimpleCommand) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.registerSimple(simpleCommands)
+}
+
+// ClearSimple removes all simple commands (and their aliases) from the
+// multiplexer.
 func (m *Mux) ClearSimple() {
-	m.SimpleCommands = make(map[string]SimpleCommand)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clearSimple()
 }
 
-// UseFuzzy both enables and builds a list of commands to fuzzy match
-// against. May result in a small performance hit
-func (m *Mux) UseFuzzy() {
-	m.fuzzyMatch = true
+// ReplaceSimple atomically replaces all simple commands and permissions, so
+// messages being handled at the same time see either the old or the new set
+// but never a mix of the two. Name collisions are handled the same way as in
+// Register.
+func (m *Mux) ReplaceSimple(
+	perms map[string]*CommandPermissions, simpleCommands ...SimpleCommand,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clearSimple()
+	m.permissions = perms
+	return m.registerSimple(simpleCommands)
+}
+
+// SetConfig atomically replaces the owners, simple commands, permissions, rate
+// limits and guild settings, so messages being handled at the same time never
+// see a mix of the old and new config. Name collisions are handled the same
+// way as in Register.
+func (m *Mux) SetConfig(c *Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.owners = c.Owners
+	m.setRateLimits(c.RateLimits)
+	m.setGuilds(c.Guilds)
+
+	m.clearSimple()
+	m.permissions = c.Permissions
+	return m.registerSimple(c.SimpleCommands)
+}
+
+// registerSimple registers simple commands. The caller must hold the lock.
+func (m *Mux) registerSimple(simpleCommands []SimpleCommand) error {
+	var errs []string
+
+	for _, c := range simpleCommands {
+		name := strings.ToLower(c.Command)
+		if len(name) == 0 {
+			continue
+		}
+
+		if err := m.checkName(name); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		m.simpleCommands[name] = c
+
+		errs = append(errs, m.registerAliases(name, c.Aliases)...)
+	}
+
+	return collisionError(errs)
+}
 
-	for k := range m.Commands {
-		m.commandNames = append(m.commandNames, k)
+// clearSimple removes all simple commands and their aliases. The caller must
+// hold the lock.
+func (m *Mux) clearSimple() {
+	for alias, name := range m.aliases {
+		if _, ok := m.simpleCommands[name]; ok {
+			delete(m.aliases, alias)
+		}
 	}
+
+	m.simpleCommands = make(map[string]SimpleCommand)
+}
+
+// UseFuzzy enables suggesting similar commands (and aliases) when a command
+// isn't found. May result in a small performance hit
+func (m *Mux) UseFuzzy() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fuzzyMatch = true
 }
 
 // Initialize calls the init functions of all registered commands to do any
 // preloading or setup before commands are to be handled. Must be called before
 // Mux.Handle() and after Mux.Register()
 func (m *Mux) Initialize() {
-	/* If no commands are loaded, and none are specified, return */
-	if len(m.Commands) == 0 {
-		return
-	}
+	m.mu.Lock()
+	m.initialized = true
+	m.mu.Unlock()
 
-	for _, c := range m.Commands {
-		c.Init(m)
+	for _, c := range m.Commands() {
+		initTree(m, c)
 	}
 }
 
@@ -186,50 +493,69 @@ func (m *Mux) Handle(
 		return
 	}
 
+	options, errorTexts := m.current()
+
 	/* Ignore if the message has no content */
-	if m.options.IgnoreEmpty && len(message.Content) == 0 {
+	if options.IgnoreEmpty && len(message.Content) == 0 {
 		return
 	}
 
 	/* Ignore if the message is not default */
-	if m.options.IgnoreNonDefault &&
+	if options.IgnoreNonDefault &&
 		message.Type != discordgo.MessageTypeDefault {
 		return
 	}
 
 	/* Ignore if the message originated from a bot */
-	if m.options.IgnoreBots && message.Author.Bot {
+	if options.IgnoreBots && message.Author.Bot {
 		return
 	}
 
 	/* Ignore if the message is in a DM */
-	if m.options.IgnoreDMs && message.GuildID == "" {
+	if options.IgnoreDMs && message.GuildID == "" {
 		return
 	}
 
 	/* Ignore if the message doesn't have the prefix */
-	if !strings.HasPrefix(message.Content, m.Prefix) {
+	prefix, content, ok := m.matchPrefix(session, message, options)
+	if !ok {
 		return
 	}
 
-	/* Split the message on the space */
-	args := strings.Split(message.Content, " ")
-	command := strings.ToLower(args[0][1:])
+	/* Separate the command from its arguments and tokenize them */
+	command, raw := splitCommand(content)
+	command = strings.ToLower(command)
+	args := Tokenize(raw)
+
+	/* Disabled simple commands can still be used by the bot's owners */
+	simple, disabled, ok := m.findGuildSimple(message.GuildID, command)
+	if ok && (!disabled || m.IsOwner(message.Author.ID)) {
+		ctx := &Context{
+			Prefix:       prefix,
+			Command:      strings.ToLower(simple.Command),
+			Arguments:    args,
+			RawArguments: raw,
+			Session:      session,
+			Message:      message,
+			members:      m.memberCache(),
+			store:        m.Storage(),
+		}
 
-	simple, ok := m.SimpleCommands[command]
-	if ok {
-		session.ChannelMessageSend(message.ChannelID, simple.Content)
+		if m.checkRateLimits(ctx, nil) {
+			m.sendSimple(ctx, simple)
+		}
 		return
 	}
 
-	handler, ok := m.Commands[command]
+	/* Find the command, routing to the deepest matching subcommand */
+	handler, path, args, ok := m.Find(append([]string{command}, args...)...)
 	/* If command does not exist, attempt to fuzzy match it */
 	if !ok {
-		if m.fuzzyMatch {
+		if names := m.fuzzyCandidates(); len(names) > 0 {
 			var sb strings.Builder
 
-			for _, fzy := range fuzzy.Find(command, m.commandNames) {
-				sb.WriteString("- `!" + fzy.Str + "`\n")
+			for _, fzy := range fuzzy.Find(command, names) {
+				sb.WriteString("- `" + prefix + fzy.Str + "`\n")
 			}
 
 			if sb.Len() != 0 {
@@ -246,89 +572,389 @@ func (m *Mux) Handle(
 
 		session.ChannelMessageSend(
 			message.ChannelID,
-			m.errorTexts.CommandNotFound,
+			errorTexts.CommandNotFound,
 		)
 
 		return
 	}
 
+	/* Drop any subcommand names from the raw arguments */
+	for range path[1:] {
+		_, raw = splitCommand(raw)
+	}
+
 	/* Form context */
-	settings := handler.Settings()
 	ctx := &Context{
-		Prefix:    m.Prefix,
-		Command:   command,
-		Arguments: args[1:],
-		Session:   session,
-		Message:   message,
+		Prefix:       prefix,
+		Command:      strings.Join(path, " "),
+		Arguments:    args,
+		RawArguments: raw,
+		Session:      session,
+		Message:      message,
+		members:      m.memberCache(),
+		store:        m.Storage(),
+	}
+
+	m.dispatch(ctx, handler, func(specs []Argument) (map[string][]interface{}, error) {
+		return parseArguments(specs, args)
+	})
+}
+
+// dispatch runs a command through the permission checks, rate limiter and
+// argument parsing before handling it and calling the middlewares. Shared by
+// both text and slash commands, which supply their own way of parsing
+// arguments.
+func (m *Mux) dispatch(
+	ctx *Context, handler Command,
+	parse func([]Argument) (map[string][]interface{}, error),
+) {
+	settings := handler.Settings()
+	_, errorTexts := m.current()
+
+	/* If permissions have been specified, check them */
+	result, err := m.Evaluate(ctx, ctx.Command)
+	if err != nil {
+		m.internalError(ctx, err, "Unable to check permissions")
+		return
+	}
+
+	m.log(func(l logrus.FieldLogger) {
+		l = l.WithFields(logrus.Fields{
+			"command": ctx.Command,
+			"user":    ctx.Message.Author.ID,
+			"channel": ctx.Message.ChannelID,
+			"result":  result.String(),
+		})
+
+		if result.Allowed {
+			l.Debug("Permission granted")
+		} else {
+			l.Info("Permission denied")
+		}
+	})
+
+	if !result.Allowed {
+		/* The user doesn't have the correct permissions */
+		options, _ := m.current()
+		if options.ExplainPermissions {
+			ctx.ChannelSendf("%s (%s)", errorTexts.NoPermissions, result)
+			return
+		}
+
+		ctx.ChannelSend(errorTexts.NoPermissions)
+		return
+	}
+
+	/* Only commands the user is allowed to run count towards rate limits, so
+	   they can't be used to use up a shared limit */
+	if !m.checkRateLimits(ctx, settings.limiter()) {
+		return
 	}
 
-	if !settings.checkLimit(message.Author.ID) {
-		ctx.ChannelSend(m.errorTexts.RateLimited)
+	/* Check the Discord permissions required by the command */
+	memberMissing, botMissing, err := ctx.checkDiscordPermissions(settings)
+	if err != nil {
+		m.internalError(ctx, err, "Unable to work out channel permissions")
 		return
 	}
 
+	if memberMissing != 0 {
+		ctx.ChannelSendf(
+			errorTexts.MemberMissingPermissions, PermissionNames(memberMissing),
+		)
+		return
+	}
+
+	if botMissing != 0 {
+		ctx.ChannelSendf(
+			errorTexts.BotMissingPermissions, PermissionNames(botMissing),
+		)
+		return
+	}
+
+	/* Parse the arguments if the command specifies them */
+	if len(settings.Arguments) > 0 {
+		parsed, err := parse(settings.Arguments)
+		if err != nil {
+			ctx.ChannelSendf(
+				"%s %s\nUsage: `%s`",
+				errorTexts.InvalidArguments, err.Error(),
+				settings.Usage(usagePrefix(ctx.Prefix, strings.Fields(ctx.Command))),
+			)
+			return
+		}
+		ctx.parsed = parsed
+	}
+
 	// TODO: Move away from middlewares and more closely integrate logging
-	/* Call middlewares */
-	if len(m.Middleware) > 0 {
-		for _, mw := range m.Middleware {
-			go mw(ctx)
+	/* Call middlewares, each with its own copy of the now complete context so
+	   they can't race with the handler */
+	m.mu.RLock()
+	middleware := m.middleware
+	m.mu.RUnlock()
+
+	for _, mw := range middleware {
+		mwCtx := *ctx
+		go mw(&mwCtx)
+	}
+
+	/* User has permissions or it doesnt require them? Run it */
+	go handler.Handle(ctx)
+}
+
+// Find looks up a command by name (or alias) followed by the names of any
+// subcommands, descending to the deepest one that matches. Returns the
+// command, the canonical path of names leading to it, the remaining
+// arguments, and whether or not the top-level command exists.
+func (m *Mux) Find(args ...string) (Command, []string, []string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(args) == 0 {
+		return nil, nil, nil, false
+	}
+
+	name := strings.ToLower(args[0])
+	if alias, ok := m.aliases[name]; ok {
+		name = alias
+	}
+
+	c, ok := m.commands[name]
+	if !ok {
+		return nil, nil, args[1:], false
+	}
+
+	c, path, rest := resolve(c, args[1:])
+	return c, append([]string{name}, path...), rest, true
+}
+
+// FindSimple looks up a simple command by name or alias.
+func (m *Mux) FindSimple(name string) (SimpleCommand, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name = strings.ToLower(name)
+	if alias, ok := m.aliases[name]; ok {
+		name = alias
+	}
+
+	c, ok := m.simpleCommands[name]
+	return c, ok
+}
+
+// CanRun checks if the author of the message in the context is allowed to run
+// the command with the given path (e.g. "role add").
+func (m *Mux) CanRun(ctx *Context, command string) (bool, error) {
+	result, err := m.Evaluate(ctx, command)
+	return result.Allowed, err
+}
+
+// Evaluate works like CanRun, but returns the rule which decided the outcome.
+// The permissions of each parent command must be satisfied as well. If neither
+// the command nor its parents have permissions of their own, the default
+// permissions are used. Owners (and admins, if enabled) bypass the permissions.
+// Commands disabled in the guild can only be used by owners.
+func (m *Mux) Evaluate(ctx *Context, command string) (PermissionResult, error) {
+	perms := m.guildPermissions(ctx.Message.GuildID)
+	guild := m.Guild(ctx.Message.GuildID)
+
+	var applied []*CommandPermissions
+
+	path := strings.Fields(command)
+	for i := range path {
+		if p, ok := perms[strings.Join(path[:i+1], " ")]; ok {
+			applied = append(applied, p)
 		}
 	}
 
-	/* If permissions have been specified, check them */
-	p, ok := m.permissions[command]
-	if ok {
-		member, err := session.GuildMember(message.GuildID, message.Author.ID)
+	if p, ok := perms[DefaultPermissions]; ok && len(applied) == 0 {
+		applied = append(applied, p)
+	}
+
+	ownerOnly := m.ownerOnly(path)
+	disabled := guild != nil && guild.disabled(command)
+	if ownerOnly || disabled || len(applied) > 0 {
+		tier, err := m.Tier(ctx)
 		if err != nil {
-			ctx.ChannelSend("There was a weird issue.")
-			return
+			return PermissionResult{}, err
+		}
+
+		userID := ctx.Message.Author.ID
+		switch {
+		case tier == TierOwner:
+			return PermissionResult{Allowed: true, Rule: RuleOwner, ID: userID}, nil
+		case ownerOnly:
+			return PermissionResult{Allowed: false, Rule: RuleOwnerOnly, ID: userID}, nil
+		case disabled:
+			return PermissionResult{Allowed: false, Rule: RuleDisabled}, nil
+		case tier == TierAdmin:
+			return PermissionResult{Allowed: true, Rule: RuleAdmin, ID: userID}, nil
+		}
+	}
+
+	result := PermissionResult{Allowed: true, Rule: RuleNone}
+	for _, p := range applied {
+		member, err := ctx.Member()
+		if err != nil {
+			return PermissionResult{}, err
 		}
 
 		/* Check the permissions struct against the context */
-		if !CheckPermissions(
-			p, member.User.ID, member.Roles, message.ChannelID,
-		) {
-			/* The user doesn't have the correct permissions */
-			ctx.ChannelSend(m.errorTexts.NoPermissions)
-			return
+		result = EvaluatePermissions(
+			p, member.User.ID, member.Roles, ctx.Message.ChannelID,
+		)
+		if !result.Allowed {
+			return result, nil
 		}
 	}
 
-	/* User has permissions or it doesnt require them? Run it */
-	go handler.Handle(ctx)
+	return result, nil
 }
 
 /* === Helper Functions === */
 
-// checkLimit checks the supplied command settings' rate limiter to see if
-// the user is allowed to run the command.
-func (cs *CommandSettings) checkLimit(id string) bool {
-	/* No rate limiter set? Ignore */
-	if cs.RateLimitDB == nil {
-		return true
+// current returns the options and error texts currently in use.
+func (m *Mux) current() (*Options, *ErrorTexts) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.options, m.errorTexts
+}
+
+// log calls the supplied function with the logger, if one is set.
+func (m *Mux) log(fn func(logrus.FieldLogger)) {
+	m.mu.RLock()
+	logger := m.logger
+	m.mu.RUnlock()
+
+	if logger != nil {
+		fn(logger)
+	}
+}
+
+// internalError logs an error which stopped a command from being checked, and
+// lets the user know something went wrong.
+func (m *Mux) internalError(ctx *Context, err error, msg string) {
+	m.log(func(l logrus.FieldLogger) {
+		l.WithError(err).WithFields(logrus.Fields{
+			"command": ctx.Command,
+			"user":    ctx.Message.Author.ID,
+			"channel": ctx.Message.ChannelID,
+		}).Error(msg)
+	})
+
+	_, errorTexts := m.current()
+	ctx.ChannelSend(errorTexts.InternalError)
+}
+
+// fuzzyCandidates returns the names and aliases of every command to fuzzy
+// match against, or nothing if fuzzy matching is disabled.
+func (m *Mux) fuzzyCandidates() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.fuzzyMatch {
+		return nil
+	}
+
+	var names []string
+	for k := range m.commands {
+		names = append(names, k)
+	}
+
+	for alias, name := range m.aliases {
+		if _, ok := m.commands[name]; ok {
+			names = append(names, alias)
+		}
+	}
+	return names
+}
+
+// checkName checks if a command name or alias is already in use.
+func (m *Mux) checkName(name string) error {
+	if _, ok := m.commands[name]; ok {
+		return fmt.Errorf("%q is already registered as a command", name)
+	}
+
+	if _, ok := m.simpleCommands[name]; ok {
+		return fmt.Errorf("%q is already registered as a simple command", name)
+	}
+
+	if owner, ok := m.aliases[name]; ok {
+		return fmt.Errorf("%q is already registered as an alias of %q", name, owner)
 	}
 
-	/* Increment limiter. Does not increase elements which do not exist */
-	cs.RateLimitDB.IncrementInt(id, 1)
+	return nil
+}
+
+// registerAliases registers the aliases of the named command, skipping any that
+// collide. Returns a message for each collision.
+func (m *Mux) registerAliases(name string, aliases []string) []string {
+	var errs []string
+
+	for _, a := range aliases {
+		a = strings.ToLower(a)
+		if len(a) == 0 {
+			continue
+		}
+
+		if err := m.checkName(a); err != nil {
+			errs = append(errs, fmt.Sprintf("alias of %q: %s", name, err))
+			continue
+		}
+		m.aliases[a] = name
+	}
 
-	uses, found := cs.RateLimitDB.Get(id)
-	/* If not found, initialize */
-	if !found {
-		cs.RateLimitDB.SetDefault(id, 1)
-		return true
+	return errs
+}
+
+// collisionError combines the collisions found during registration into a
+// single error.
+func collisionError(errs []string) error {
+	if len(errs) == 0 {
+		return nil
 	}
+	return fmt.Errorf("name collisions: %s", strings.Join(errs, "; "))
+}
 
-	/* Check uses (add 1 since we've incremented the value) */
-	if uses.(int) < cs.RateLimitMax+1 {
-		return true
+// registerError combines the name collisions and invalid argument
+// specifications found while registering commands into a single error.
+func registerError(collisions, invalid []string) error {
+	err := collisionError(collisions)
+	if len(invalid) == 0 {
+		return err
 	}
 
-	return false
+	msg := "invalid arguments: " + strings.Join(invalid, "; ")
+	if err != nil {
+		msg = err.Error() + "; " + msg
+	}
+	return errors.New(msg)
+}
+
+// usagePrefix builds the text preceding the name of the command at the end of
+// path in a usage string, e.g. "!role " for the path "role add".
+func usagePrefix(prefix string, path []string) string {
+	if len(path) < 2 {
+		return prefix
+	}
+	return prefix + strings.Join(path[:len(path)-1], " ") + " "
+}
+
+// Storage returns the store commands can use to keep data between restarts,
+// or nil if none has been set. Same as Mux.Storage().
+func (ctx *Context) Storage() storage.Store {
+	return ctx.store
 }
 
 // ChannelSend is a helper function for easily sending a message to the current
-// channel.
+// channel. For slash commands, the message is sent as the response to the
+// interaction (or as a follow-up if it has already been responded to), and no
+// message is returned for the first response.
 func (ctx *Context) ChannelSend(message string) (*discordgo.Message, error) {
+	if ctx.Interaction != nil {
+		return ctx.respond(message)
+	}
 	return ctx.Session.ChannelMessageSend(ctx.Message.ChannelID, message)
 }
 
@@ -338,31 +964,5 @@ func (ctx *Context) ChannelSendf(
 	format string,
 	a ...interface{},
 ) (*discordgo.Message, error) {
-	return ctx.Session.ChannelMessageSend(
-		ctx.Message.ChannelID, fmt.Sprintf(format, a...),
-	)
-}
-
-// CheckPermissions takes the user, role(s), and channel IDs and checks them
-// against the supplied permissions struct.
-func CheckPermissions(
-	perms *CommandPermissions,
-	userID string, roleIDs []string, chanID string,
-) bool {
-	// TODO: Fix this gnarly logic
-	if len(perms.UserIDs) == 0 && len(perms.RoleIDs) == 0 && len(perms.ChanIDs) == 0 {
-		return true
-	}
-
-	if util.ArrayContains(perms.UserIDs, userID, true) {
-		return true
-	}
-
-	for _, id := range roleIDs {
-		if util.ArrayContains(perms.RoleIDs, id, true) {
-			return true
-		}
-	}
-
-	return util.ArrayContains(perms.ChanIDs, chanID, true)
+	return ctx.ChannelSend(fmt.Sprintf(format, a...))
 }
@@ -0,0 +1,248 @@
+package multiplexer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// replyTransport answers every request with an empty message, so messages can
+// be handled without a real (or fake) Discord API.
+type replyTransport struct{}
+
+func (replyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id": "message"}`)),
+		Request:    r,
+	}, nil
+}
+
+// guildMessage builds a message sent in a guild.
+func guildMessage(id int, content string) *discordgo.MessageCreate {
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        fmt.Sprint(id),
+		ChannelID: "channel",
+		GuildID:   "guild",
+		Content:   content,
+		Type:      discordgo.MessageTypeDefault,
+		Author:    &discordgo.User{ID: "user"},
+	}}
+}
+
+// TestConcurrentChanges handles thousands of messages while commands and
+// simple commands are changed underneath them. Run with -race.
+func TestConcurrentChanges(t *testing.T) {
+	session, _ := discordgo.New("Bot token")
+	session.State.User = &discordgo.User{ID: "app"}
+	session.Client = &http.Client{Transport: replyTransport{}}
+
+	var pings, temps int64
+	ping := testCommand{
+		settings: &CommandSettings{
+			Command:   "ping",
+			Arguments: []Argument{{Name: "times", Type: ArgInt, Default: "1"}},
+		},
+		handle: func(ctx *Context) { atomic.AddInt64(&pings, 1) },
+	}
+	temp := testCommand{
+		settings: &CommandSettings{Command: "temp", Aliases: []string{"tmp"}},
+		handle:   func(ctx *Context) { atomic.AddInt64(&temps, 1) },
+	}
+
+	m, _ := New("!", "?")
+	m.SetOptions(&Options{
+		IgnoreBots: true, IgnoreDMs: true, IgnoreEmpty: true,
+		IgnoreNonDefault: true, MentionPrefix: true,
+	})
+	if err := m.Register(ping); err != nil {
+		t.Fatal(err)
+	}
+	m.Initialize()
+
+	const (
+		senders  = 8
+		messages = 500
+	)
+	contents := []string{
+		"!ping", "?ping 3", "!temp", "!tmp", "!hello", "!hi", "!missing",
+		"hello", "",
+	}
+
+	stop := make(chan struct{})
+	var changers sync.WaitGroup
+
+	changers.Add(1)
+	go func() {
+		defer changers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			m.Register(temp)
+			m.Commands()
+			m.Unregister("temp")
+		}
+	}()
+
+	changers.Add(1)
+	go func() {
+		defer changers.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			perms := map[string]*CommandPermissions{
+				"unused": {UserIDs: []string{fmt.Sprint(i)}},
+			}
+			m.ReplaceSimple(perms, SimpleCommand{
+				Command:  "hello",
+				Content:  fmt.Sprintf("Hello #%d", i),
+				Aliases:  []string{"hi"},
+				Template: i%2 == 0,
+			})
+			m.SimpleCommands()
+			if i%10 == 0 {
+				m.ClearSimple()
+			}
+		}
+	}()
+
+	var senderGroup sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		senderGroup.Add(1)
+		go func(s int) {
+			defer senderGroup.Done()
+			for i := 0; i < messages; i++ {
+				content := contents[(s+i)%len(contents)]
+				m.Handle(session, guildMessage(s*messages+i, content))
+			}
+		}(s)
+	}
+
+	senderGroup.Wait()
+	close(stop)
+	changers.Wait()
+
+	/* Handlers run in their own goroutines, so give them a moment to finish */
+	expected := int64(0)
+	for s := 0; s < senders; s++ {
+		for i := 0; i < messages; i++ {
+			switch contents[(s+i)%len(contents)] {
+			case "!ping", "?ping 3":
+				expected++
+			}
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&pings) != expected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt64(&pings); got != expected {
+		t.Errorf("expected ping to be handled %d times, got %d", expected, got)
+	}
+}
+
+func TestUnregisterRemovesAliases(t *testing.T) {
+	m, _ := New("!")
+	m.Register(testCommand{
+		settings: &CommandSettings{Command: "temp", Aliases: []string{"tmp"}},
+	})
+
+	if _, _, _, ok := m.Find("tmp"); !ok {
+		t.Fatal("expected the alias to be registered")
+	}
+
+	m.Unregister("TEMP")
+	if _, _, _, ok := m.Find("temp"); ok {
+		t.Error("expected the command to be unregistered")
+	}
+	if _, _, _, ok := m.Find("tmp"); ok {
+		t.Error("expected the alias to be unregistered")
+	}
+
+	/* The alias is free to be used again */
+	if err := m.RegisterSimple(SimpleCommand{Command: "tmp"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplaceSimple(t *testing.T) {
+	m, _ := New("!")
+	m.Register(testCommand{settings: &CommandSettings{Command: "ping"}})
+	m.RegisterSimple(SimpleCommand{Command: "old", Aliases: []string{"o"}})
+
+	err := m.ReplaceSimple(nil,
+		SimpleCommand{Command: "new", Aliases: []string{"o"}},
+		SimpleCommand{Command: "ping"},
+	)
+	if err == nil {
+		t.Error("expected the collision with ping to be reported")
+	}
+
+	if _, ok := m.FindSimple("old"); ok {
+		t.Error("expected the old simple command to be removed")
+	}
+	if s, ok := m.FindSimple("o"); !ok || s.Command != "new" {
+		t.Errorf("expected the alias to point at the new command, got %v", s)
+	}
+	if _, _, _, ok := m.Find("ping"); !ok {
+		t.Error("expected ping to still be registered")
+	}
+}
+
+// TestMiddlewareContext checks middlewares can read the parsed arguments and
+// member while the command is being handled. Run with -race.
+func TestMiddlewareContext(t *testing.T) {
+	session, _ := discordgo.New("Bot token")
+	session.State.User = &discordgo.User{ID: "app"}
+	session.Client = &http.Client{Transport: replyTransport{}}
+
+	const messages = 200
+	var handled, seen sync.WaitGroup
+	handled.Add(messages)
+	seen.Add(messages)
+
+	m, _ := New("!")
+	m.Register(testCommand{
+		settings: &CommandSettings{
+			Command:   "ping",
+			Arguments: []Argument{{Name: "times", Type: ArgInt, Default: "1"}},
+		},
+		handle: func(ctx *Context) {
+			defer handled.Done()
+			ctx.Int("times")
+			ctx.Member()
+		},
+	})
+	m.UseMiddleware(func(ctx *Context) {
+		defer seen.Done()
+		if ctx.Int("times") != 3 {
+			t.Errorf("expected the middleware to see 3, got %d", ctx.Int("times"))
+		}
+		ctx.Member()
+	})
+	m.Initialize()
+
+	for i := 0; i < messages; i++ {
+		m.Handle(session, guildMessage(i, "!ping 3"))
+	}
+
+	handled.Wait()
+	seen.Wait()
+}
@@ -0,0 +1,201 @@
+package multiplexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
+)
+
+type (
+	// CommandPermissions holds the allow and deny lists of user, role and
+	// channel IDs for a given command. Rules are evaluated in the order given
+	// by Precedence (or DefaultPrecedence if empty) and the first rule to match
+	// decides the outcome. If no rule matches, the command is denied if there
+	// are any allow lists, and allowed otherwise.
+	CommandPermissions struct {
+		UserIDs []string
+		RoleIDs []string
+		ChanIDs []string
+
+		DenyUserIDs []string
+		DenyRoleIDs []string
+		DenyChanIDs []string
+
+		Precedence []Rule
+	}
+
+	// Rule is a single allow or deny list checked when evaluating permissions.
+	Rule int
+
+	// PermissionResult is the outcome of evaluating permissions, along with
+	// the rule (and the ID matched by it) which decided it.
+	PermissionResult struct {
+		Allowed bool
+		Rule    Rule
+		ID      string
+	}
+)
+
+// Permission rules. RuleNone is used in results when no rule matched, while
+// RuleOwner, RuleAdmin and RuleOwnerOnly are used when the user's tier decided
+// the outcome, and RuleDisabled when the command is disabled in the guild; none
+// of them can be used in a precedence list.
+const (
+	RuleNone Rule = iota
+	RuleDenyUser
+	RuleAllowUser
+	RuleDenyRole
+	RuleAllowRole
+	RuleDenyChannel
+	RuleAllowChannel
+	RuleOwner
+	RuleAdmin
+	RuleOwnerOnly
+	RuleDisabled
+)
+
+var (
+	// DefaultPrecedence checks every deny list before any allow list, so
+	// anything denied stays denied whichever allow lists it's also on. Within
+	// each, users are checked before roles before channels.
+	DefaultPrecedence = []Rule{
+		RuleDenyUser, RuleDenyRole, RuleDenyChannel,
+		RuleAllowUser, RuleAllowRole, RuleAllowChannel,
+	}
+
+	ruleNames = map[Rule]string{
+		RuleNone:         "none",
+		RuleDenyUser:     "deny-user",
+		RuleAllowUser:    "allow-user",
+		RuleDenyRole:     "deny-role",
+		RuleAllowRole:    "allow-role",
+		RuleDenyChannel:  "deny-channel",
+		RuleAllowChannel: "allow-channel",
+		RuleOwner:        "owner",
+		RuleAdmin:        "admin",
+		RuleOwnerOnly:    "owner-only",
+		RuleDisabled:     "disabled",
+	}
+)
+
+// ParseRule converts the name of a rule (e.g. "deny-user") to a Rule.
+func ParseRule(name string) (Rule, error) {
+	for _, r := range DefaultPrecedence {
+		if strings.EqualFold(r.String(), name) {
+			return r, nil
+		}
+	}
+	return RuleNone, fmt.Errorf("unknown permission rule %q", name)
+}
+
+// String returns the name of the rule.
+func (r Rule) String() string {
+	return ruleNames[r]
+}
+
+// String explains the result in a human-readable way, e.g. "denied: role 123
+// is on the deny list".
+func (r PermissionResult) String() string {
+	outcome := "denied"
+	if r.Allowed {
+		outcome = "allowed"
+	}
+
+	switch r.Rule {
+	case RuleDenyUser, RuleDenyRole, RuleDenyChannel:
+		return fmt.Sprintf("%s: %s %s is on the deny list", outcome, r.kind(), r.ID)
+	case RuleAllowUser, RuleAllowRole, RuleAllowChannel:
+		return fmt.Sprintf("%s: %s %s is on the allow list", outcome, r.kind(), r.ID)
+	case RuleOwner:
+		return fmt.Sprintf("%s: user %s is a bot owner", outcome, r.ID)
+	case RuleAdmin:
+		return fmt.Sprintf("%s: user %s is a guild administrator", outcome, r.ID)
+	case RuleOwnerOnly:
+		return outcome + ": only bot owners can use this command"
+	case RuleDisabled:
+		return outcome + ": command is disabled in this guild"
+	}
+
+	if r.Allowed {
+		return outcome + ": no allow list applies"
+	}
+	return outcome + ": not on any allow list"
+}
+
+// kind returns the type of ID the rule of the result checks.
+func (r PermissionResult) kind() string {
+	switch r.Rule {
+	case RuleDenyUser, RuleAllowUser:
+		return "user"
+	case RuleDenyRole, RuleAllowRole:
+		return "role"
+	default:
+		return "channel"
+	}
+}
+
+// CheckPermissions takes the user, role(s), and channel IDs and checks them
+// against the supplied permissions struct.
+func CheckPermissions(
+	perms *CommandPermissions,
+	userID string, roleIDs []string, chanID string,
+) bool {
+	return EvaluatePermissions(perms, userID, roleIDs, chanID).Allowed
+}
+
+// EvaluatePermissions works like CheckPermissions, but returns which rule
+// decided the outcome.
+func EvaluatePermissions(
+	perms *CommandPermissions,
+	userID string, roleIDs []string, chanID string,
+) PermissionResult {
+	precedence := perms.Precedence
+	if len(precedence) == 0 {
+		precedence = DefaultPrecedence
+	}
+
+	for _, rule := range precedence {
+		if id, ok := perms.match(rule, userID, roleIDs, chanID); ok {
+			allowed := rule == RuleAllowUser || rule == RuleAllowRole ||
+				rule == RuleAllowChannel
+			return PermissionResult{Allowed: allowed, Rule: rule, ID: id}
+		}
+	}
+
+	/* Nothing matched. Only allow if there's nothing to be whitelisted on */
+	return PermissionResult{
+		Allowed: len(perms.UserIDs) == 0 && len(perms.RoleIDs) == 0 &&
+			len(perms.ChanIDs) == 0,
+		Rule: RuleNone,
+	}
+}
+
+// match checks a single rule, returning the ID it matched.
+func (p *CommandPermissions) match(
+	rule Rule, userID string, roleIDs []string, chanID string,
+) (string, bool) {
+	var list, ids []string
+
+	switch rule {
+	case RuleDenyUser:
+		list, ids = p.DenyUserIDs, []string{userID}
+	case RuleAllowUser:
+		list, ids = p.UserIDs, []string{userID}
+	case RuleDenyRole:
+		list, ids = p.DenyRoleIDs, roleIDs
+	case RuleAllowRole:
+		list, ids = p.RoleIDs, roleIDs
+	case RuleDenyChannel:
+		list, ids = p.DenyChanIDs, []string{chanID}
+	case RuleAllowChannel:
+		list, ids = p.ChanIDs, []string{chanID}
+	}
+
+	for _, id := range ids {
+		if util.ArrayContains(list, id, true) {
+			return id, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,172 @@
+package multiplexer
+
+import "testing"
+
+func TestEvaluatePermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		perms   CommandPermissions
+		roles   []string
+		channel string
+
+		allowed bool
+		rule    Rule
+		id      string
+	}{
+		{
+			name:    "no lists",
+			allowed: true, rule: RuleNone,
+		},
+		{
+			name:    "only deny lists which don't match",
+			perms:   CommandPermissions{DenyUserIDs: []string{"other"}},
+			allowed: true, rule: RuleNone,
+		},
+		{
+			name:    "not on the allow list",
+			perms:   CommandPermissions{UserIDs: []string{"other"}},
+			allowed: false, rule: RuleNone,
+		},
+		{
+			name:    "allowed user",
+			perms:   CommandPermissions{UserIDs: []string{"user"}},
+			allowed: true, rule: RuleAllowUser, id: "user",
+		},
+		{
+			name:    "allowed role",
+			perms:   CommandPermissions{RoleIDs: []string{"mod"}},
+			roles:   []string{"member", "mod"},
+			allowed: true, rule: RuleAllowRole, id: "mod",
+		},
+		{
+			name:    "allowed channel",
+			perms:   CommandPermissions{ChanIDs: []string{"bots"}},
+			channel: "bots",
+			allowed: true, rule: RuleAllowChannel, id: "bots",
+		},
+		{
+			name:    "denied user",
+			perms:   CommandPermissions{DenyUserIDs: []string{"user"}},
+			allowed: false, rule: RuleDenyUser, id: "user",
+		},
+		{
+			name:    "denied role",
+			perms:   CommandPermissions{DenyRoleIDs: []string{"muted"}},
+			roles:   []string{"muted"},
+			allowed: false, rule: RuleDenyRole, id: "muted",
+		},
+		{
+			name:    "denied channel",
+			perms:   CommandPermissions{DenyChanIDs: []string{"general"}},
+			channel: "general",
+			allowed: false, rule: RuleDenyChannel, id: "general",
+		},
+		{
+			name: "user deny beats user allow",
+			perms: CommandPermissions{
+				UserIDs: []string{"user"}, DenyUserIDs: []string{"user"},
+			},
+			allowed: false, rule: RuleDenyUser, id: "user",
+		},
+		{
+			name: "role deny beats user allow",
+			perms: CommandPermissions{
+				UserIDs: []string{"user"}, DenyRoleIDs: []string{"muted"},
+			},
+			roles:   []string{"muted"},
+			allowed: false, rule: RuleDenyRole, id: "muted",
+		},
+		{
+			name: "channel deny beats role allow",
+			perms: CommandPermissions{
+				RoleIDs: []string{"mod"}, DenyChanIDs: []string{"general"},
+			},
+			roles:   []string{"mod"},
+			channel: "general",
+			allowed: false, rule: RuleDenyChannel, id: "general",
+		},
+		{
+			name: "channel deny beats user allow",
+			perms: CommandPermissions{
+				UserIDs: []string{"user"}, DenyChanIDs: []string{"general"},
+			},
+			channel: "general",
+			allowed: false, rule: RuleDenyChannel, id: "general",
+		},
+		{
+			name: "role allow in another channel",
+			perms: CommandPermissions{
+				RoleIDs: []string{"mod"}, DenyChanIDs: []string{"general"},
+			},
+			roles:   []string{"mod"},
+			channel: "bots",
+			allowed: true, rule: RuleAllowRole, id: "mod",
+		},
+		{
+			name: "user allow is checked before channel allow",
+			perms: CommandPermissions{
+				UserIDs: []string{"user"}, ChanIDs: []string{"bots"},
+			},
+			channel: "bots",
+			allowed: true, rule: RuleAllowUser, id: "user",
+		},
+		{
+			name: "custom precedence lets allowed users through",
+			perms: CommandPermissions{
+				UserIDs:     []string{"user"},
+				DenyRoleIDs: []string{"muted"},
+				Precedence: []Rule{
+					RuleAllowUser, RuleDenyUser, RuleDenyRole,
+					RuleDenyChannel, RuleAllowRole, RuleAllowChannel,
+				},
+			},
+			roles:   []string{"muted"},
+			allowed: true, rule: RuleAllowUser, id: "user",
+		},
+		{
+			name: "rules left out of the precedence are ignored",
+			perms: CommandPermissions{
+				DenyUserIDs: []string{"user"},
+				Precedence:  []Rule{RuleDenyRole},
+			},
+			allowed: true, rule: RuleNone,
+		},
+		{
+			name: "ids are case insensitive",
+			perms: CommandPermissions{
+				DenyChanIDs: []string{"GENERAL"},
+			},
+			channel: "general",
+			allowed: false, rule: RuleDenyChannel, id: "general",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EvaluatePermissions(&tt.perms, "user", tt.roles, tt.channel)
+			expected := PermissionResult{Allowed: tt.allowed, Rule: tt.rule, ID: tt.id}
+
+			if result != expected {
+				t.Errorf("expected %q, got %q", expected, result)
+			}
+			if CheckPermissions(&tt.perms, "user", tt.roles, tt.channel) != tt.allowed {
+				t.Errorf("CheckPermissions doesn't agree with EvaluatePermissions")
+			}
+		})
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	for _, rule := range DefaultPrecedence {
+		parsed, err := ParseRule(rule.String())
+		if err != nil || parsed != rule {
+			t.Errorf("expected %s to parse, got %v (%v)", rule, parsed, err)
+		}
+	}
+
+	for _, name := range []string{"owner", "admin", "disabled", "allow"} {
+		if _, err := ParseRule(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
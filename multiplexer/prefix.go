@@ -0,0 +1,87 @@
+package multiplexer
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// PrefixResolver returns the prefixes to use for the given guild (empty for
+// DMs), allowing each guild to have its own. If it returns no prefixes, the
+// prefixes the multiplexer was created with are used.
+type PrefixResolver func(guildID string) []string
+
+// SetPrefixResolver sets the function used to look up the prefixes of each
+// guild.
+func (m *Mux) SetPrefixResolver(resolver PrefixResolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prefixResolver = resolver
+}
+
+// GuildPrefixes returns the prefixes in use for the given guild, taken from
+// the guild's settings, then the prefix resolver, then the prefixes the
+// multiplexer was created with. The first prefix is the guild's default.
+func (m *Mux) GuildPrefixes(guildID string) []string {
+	m.mu.RLock()
+	resolver := m.prefixResolver
+	guild := m.guilds[guildID]
+	m.mu.RUnlock()
+
+	if guild != nil && len(guild.Prefixes) > 0 {
+		return guild.Prefixes
+	}
+
+	if resolver != nil {
+		if prefixes := resolver(guildID); len(prefixes) > 0 {
+			return prefixes
+		}
+	}
+	return m.Prefixes
+}
+
+/* === Helper Functions === */
+
+// matchPrefix checks a message for any of the prefixes of the guild it was
+// sent in, or a mention of the bot if enabled. Returns the prefix to show in
+// replies, the content of the message following the prefix, and whether or
+// not a prefix was found.
+func (m *Mux) matchPrefix(
+	session *discordgo.Session, message *discordgo.MessageCreate,
+	options *Options,
+) (string, string, bool) {
+	prefixes := m.GuildPrefixes(message.GuildID)
+
+	/* Mentions are replied to with the default prefix, since it's easier to
+	   type in usage examples */
+	if options.MentionPrefix {
+		for _, mention := range []string{
+			"<@" + session.State.User.ID + ">",
+			"<@!" + session.State.User.ID + ">",
+		} {
+			if strings.HasPrefix(message.Content, mention) {
+				return prefixes[0], strings.TrimLeftFunc(
+					message.Content[len(mention):], unicode.IsSpace,
+				), true
+			}
+		}
+	}
+
+	/* Check the longest prefixes first so "!!" isn't mistaken for "!" */
+	sorted := make([]string, len(prefixes))
+	copy(sorted, prefixes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	for _, p := range sorted {
+		if len(p) != 0 && strings.HasPrefix(message.Content, p) {
+			return p, message.Content[len(p):], true
+		}
+	}
+
+	return "", "", false
+}
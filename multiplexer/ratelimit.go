@@ -0,0 +1,604 @@
+package multiplexer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/patrickmn/go-cache"
+)
+
+type (
+	// RateLimiter decides whether a command can be used again. Allow records a
+	// use of the command and reports whether it's allowed, along with how long
+	// to wait before trying again if it isn't.
+	RateLimiter interface {
+		Allow(ctx *Context) (bool, time.Duration)
+	}
+
+	// Refunder is implemented by rate limiters which can take back the last
+	// use Allow recorded. When several limits apply to a command and a later
+	// one denies it, the uses recorded by the earlier ones are refunded so a
+	// command which wasn't run isn't counted against them.
+	Refunder interface {
+		Refund(ctx *Context)
+	}
+
+	// LimitScope decides who shares a rate limit.
+	LimitScope int
+
+	// LimitType is the algorithm used by a rate limiter created from a
+	// LimitSpec.
+	LimitType int
+
+	// LimitSpec describes a rate limiter, so limits can be defined in the
+	// config. Limit uses are allowed per Window. For token buckets, Limit is
+	// the size of the bucket, which takes Window to refill completely.
+	LimitSpec struct {
+		Type   LimitType
+		Limit  int
+		Window time.Duration
+		Scope  LimitScope
+	}
+
+	// RateLimits are applied on top of the rate limiters set by each command.
+	// Global limits every command, Commands limits individual commands (and
+	// simple commands) by name, and Guilds limits every command in a guild.
+	RateLimits struct {
+		Global   *LimitSpec
+		Commands map[string]LimitSpec
+		Guilds   map[string]LimitSpec
+	}
+
+	// specLimiter is a rate limiter created from a LimitSpec, which is kept
+	// so the limiter (and its state) can be reused if the spec doesn't change.
+	specLimiter struct {
+		spec    LimitSpec
+		limiter RateLimiter
+	}
+
+	// FixedWindow allows Limit uses per Window. The window starts at the first
+	// use and resets once it's over.
+	FixedWindow struct {
+		Limit  int
+		Window time.Duration
+		Scope  LimitScope
+
+		state limiterState
+	}
+
+	// SlidingWindow allows Limit uses in any period of length Window, so bursts
+	// at the end of one window and the start of the next aren't let through.
+	SlidingWindow struct {
+		Limit  int
+		Window time.Duration
+		Scope  LimitScope
+
+		state limiterState
+	}
+
+	// TokenBucket allows bursts of up to Capacity uses, regaining one use every
+	// Interval.
+	TokenBucket struct {
+		Capacity int
+		Interval time.Duration
+		Scope    LimitScope
+
+		state limiterState
+	}
+
+	// limiterState holds the state of a limiter for each key, forgetting keys
+	// which haven't been used in a while so the map doesn't keep growing.
+	limiterState struct {
+		sync.Mutex
+		entries map[string]interface{}
+		used    map[string]time.Time
+		swept   time.Time
+	}
+
+	fixedEntry struct {
+		start time.Time
+		count int
+	}
+
+	bucketEntry struct {
+		tokens float64
+		last   time.Time
+	}
+
+	// cacheLimiter adapts the RateLimitMax and RateLimitDB settings to a
+	// RateLimiter.
+	cacheLimiter struct {
+		max int
+		db  *cache.Cache
+	}
+)
+
+// globalLimitKey is the key the global rate limit is stored under.
+const globalLimitKey = "global"
+
+// defaultWarningCooldown is how long to wait before warning a user about a rate
+// limit again, for limiters which don't say when the command can be used.
+const defaultWarningCooldown = 5 * time.Second
+
+// Rate limit scopes
+const (
+	ScopeUser LimitScope = iota
+	ScopeChannel
+	ScopeGuild
+	ScopeGlobal
+)
+
+// Rate limiter types
+const (
+	LimitSlidingWindow LimitType = iota
+	LimitFixedWindow
+	LimitTokenBucket
+)
+
+var (
+	limitScopeNames = map[LimitScope]string{
+		ScopeUser:    "user",
+		ScopeChannel: "channel",
+		ScopeGuild:   "guild",
+		ScopeGlobal:  "global",
+	}
+
+	limitTypeNames = map[LimitType]string{
+		LimitSlidingWindow: "sliding-window",
+		LimitFixedWindow:   "fixed-window",
+		LimitTokenBucket:   "token-bucket",
+	}
+)
+
+// ParseLimitScope converts the name of a scope (e.g. "channel") to a
+// LimitScope.
+func ParseLimitScope(name string) (LimitScope, error) {
+	for s, n := range limitScopeNames {
+		if strings.EqualFold(n, name) {
+			return s, nil
+		}
+	}
+	return ScopeUser, fmt.Errorf("unknown rate limit scope %q", name)
+}
+
+// String returns the name of the scope.
+func (s LimitScope) String() string {
+	return limitScopeNames[s]
+}
+
+// ParseLimitType converts the name of a rate limiter type (e.g.
+// "token-bucket") to a LimitType.
+func ParseLimitType(name string) (LimitType, error) {
+	for t, n := range limitTypeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	return LimitSlidingWindow, fmt.Errorf("unknown rate limiter type %q", name)
+}
+
+// String returns the name of the rate limiter type.
+func (t LimitType) String() string {
+	return limitTypeNames[t]
+}
+
+// New creates a rate limiter from the spec.
+func (s LimitSpec) New() RateLimiter {
+	switch s.Type {
+	case LimitFixedWindow:
+		return NewFixedWindow(s.Limit, s.Window, s.Scope)
+	case LimitTokenBucket:
+		interval := s.Window
+		if s.Limit > 0 {
+			interval /= time.Duration(s.Limit)
+		}
+		return NewTokenBucket(s.Limit, interval, s.Scope)
+	default:
+		return NewSlidingWindow(s.Limit, s.Window, s.Scope)
+	}
+}
+
+// SetRateLimits sets the rate limits applied on top of those set by each
+// command. Limiters whose spec hasn't changed keep their state, so reloading
+// the config doesn't reset every limit.
+func (m *Mux) SetRateLimits(limits *RateLimits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setRateLimits(limits)
+}
+
+// NewFixedWindow creates a fixed window rate limiter.
+func NewFixedWindow(
+	limit int, window time.Duration, scope LimitScope,
+) *FixedWindow {
+	return &FixedWindow{Limit: limit, Window: window, Scope: scope}
+}
+
+// NewSlidingWindow creates a sliding window rate limiter.
+func NewSlidingWindow(
+	limit int, window time.Duration, scope LimitScope,
+) *SlidingWindow {
+	return &SlidingWindow{Limit: limit, Window: window, Scope: scope}
+}
+
+// NewTokenBucket creates a token bucket rate limiter, starting full.
+func NewTokenBucket(
+	capacity int, interval time.Duration, scope LimitScope,
+) *TokenBucket {
+	return &TokenBucket{Capacity: capacity, Interval: interval, Scope: scope}
+}
+
+// Key returns the key the context is rate limited under for the scope. In DMs,
+// the guild scope falls back to the channel.
+func (s LimitScope) Key(ctx *Context) string {
+	switch s {
+	case ScopeChannel:
+		return ctx.Message.ChannelID
+	case ScopeGuild:
+		if len(ctx.Message.GuildID) == 0 {
+			return ctx.Message.ChannelID
+		}
+		return ctx.Message.GuildID
+	case ScopeGlobal:
+		return ""
+	default:
+		return ctx.Message.Author.ID
+	}
+}
+
+// Allow implements RateLimiter.
+func (l *FixedWindow) Allow(ctx *Context) (bool, time.Duration) {
+	now := time.Now()
+	key := l.Scope.Key(ctx)
+
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	e, _ := l.state.get(key, now, l.Window).(*fixedEntry)
+	if e == nil || now.Sub(e.start) >= l.Window {
+		e = &fixedEntry{start: now}
+		l.state.entries[key] = e
+	}
+
+	if e.count >= l.Limit {
+		return false, e.start.Add(l.Window).Sub(now)
+	}
+
+	e.count++
+	return true, 0
+}
+
+// Allow implements RateLimiter.
+func (l *SlidingWindow) Allow(ctx *Context) (bool, time.Duration) {
+	now := time.Now()
+	key := l.Scope.Key(ctx)
+
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	uses, _ := l.state.get(key, now, l.Window).([]time.Time)
+
+	/* Drop uses which have slid out of the window */
+	for len(uses) > 0 && now.Sub(uses[0]) >= l.Window {
+		uses = uses[1:]
+	}
+
+	if len(uses) >= l.Limit {
+		l.state.entries[key] = uses
+		if len(uses) == 0 {
+			return false, l.Window
+		}
+		return false, uses[0].Add(l.Window).Sub(now)
+	}
+
+	l.state.entries[key] = append(uses, now)
+	return true, 0
+}
+
+// Allow implements RateLimiter.
+func (l *TokenBucket) Allow(ctx *Context) (bool, time.Duration) {
+	now := time.Now()
+	key := l.Scope.Key(ctx)
+	capacity := float64(l.Capacity)
+
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	/* Buckets are forgotten once they'd have refilled anyway */
+	ttl := l.Interval * time.Duration(l.Capacity)
+	e, _ := l.state.get(key, now, ttl).(*bucketEntry)
+	if e == nil {
+		e = &bucketEntry{tokens: capacity, last: now}
+		l.state.entries[key] = e
+	}
+
+	if l.Interval > 0 {
+		e.tokens += float64(now.Sub(e.last)) / float64(l.Interval)
+	}
+	if e.tokens > capacity {
+		e.tokens = capacity
+	}
+	e.last = now
+
+	if e.tokens < 1 {
+		if l.Interval <= 0 {
+			return false, 0
+		}
+		return false, time.Duration((1 - e.tokens) * float64(l.Interval))
+	}
+
+	e.tokens--
+	return true, 0
+}
+
+// Allow implements RateLimiter. Uses are counted per user until the cache
+// expires the entry.
+func (l cacheLimiter) Allow(ctx *Context) (bool, time.Duration) {
+	id := ctx.Message.Author.ID
+
+	/* Add only succeeds for the first use, so concurrent messages can't both
+	   be counted as the first */
+	if l.db.Add(id, 1, cache.DefaultExpiration) == nil {
+		return true, 0
+	}
+
+	uses, err := l.db.IncrementInt(id, 1)
+	if err != nil {
+		/* Expired in between, so start again */
+		l.db.Set(id, 1, cache.DefaultExpiration)
+		return true, 0
+	}
+
+	if uses <= l.max {
+		return true, 0
+	}
+
+	_, expires, ok := l.db.GetWithExpiration(id)
+	if !ok || expires.IsZero() {
+		return false, 0
+	}
+	return false, time.Until(expires)
+}
+
+// Refund implements Refunder.
+func (l *FixedWindow) Refund(ctx *Context) {
+	key := l.Scope.Key(ctx)
+
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	if e, ok := l.state.entries[key].(*fixedEntry); ok && e.count > 0 {
+		e.count--
+	}
+}
+
+// Refund implements Refunder.
+func (l *SlidingWindow) Refund(ctx *Context) {
+	key := l.Scope.Key(ctx)
+
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	if uses, ok := l.state.entries[key].([]time.Time); ok && len(uses) > 0 {
+		l.state.entries[key] = uses[:len(uses)-1]
+	}
+}
+
+// Refund implements Refunder.
+func (l *TokenBucket) Refund(ctx *Context) {
+	key := l.Scope.Key(ctx)
+
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	if e, ok := l.state.entries[key].(*bucketEntry); ok {
+		e.tokens++
+		if e.tokens > float64(l.Capacity) {
+			e.tokens = float64(l.Capacity)
+		}
+	}
+}
+
+// Refund implements Refunder.
+func (l cacheLimiter) Refund(ctx *Context) {
+	l.db.DecrementInt(ctx.Message.Author.ID, 1)
+}
+
+/* === Helper Functions === */
+
+// setRateLimits sets the rate limits applied on top of those set by each
+// command. The caller must hold the lock.
+func (m *Mux) setRateLimits(limits *RateLimits) {
+	specs := make(map[string]LimitSpec)
+	if limits != nil {
+		if limits.Global != nil {
+			specs[globalLimitKey] = *limits.Global
+		}
+		for name, spec := range limits.Commands {
+			specs[commandLimitKey(name)] = spec
+		}
+		for id, spec := range limits.Guilds {
+			specs[guildLimitKey(id)] = spec
+		}
+	}
+
+	out := make(map[string]*specLimiter, len(specs))
+	for key, spec := range specs {
+		if old, ok := m.rateLimits[key]; ok && old.spec == spec {
+			out[key] = old
+			continue
+		}
+		out[key] = &specLimiter{spec, spec.New()}
+	}
+	m.rateLimits = out
+}
+
+// checkRateLimits checks the command's own rate limiter, followed by the rate
+// limits set for the command, the guild, and globally. Owners and admins
+// aren't rate limited. If any limit denies the command, the uses recorded by
+// the limits before it are refunded. Lets the user know if they've been rate
+// limited, and returns whether the command can be used.
+func (m *Mux) checkRateLimits(ctx *Context, limiter RateLimiter) bool {
+	m.mu.RLock()
+	limiters := make([]RateLimiter, 0, 4)
+	if limiter != nil {
+		limiters = append(limiters, limiter)
+	}
+	for _, key := range []string{
+		commandLimitKey(ctx.Command),
+		guildLimitKey(ctx.Message.GuildID),
+		globalLimitKey,
+	} {
+		if l, ok := m.rateLimits[key]; ok {
+			limiters = append(limiters, l.limiter)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(limiters) == 0 {
+		return true
+	}
+
+	tier, err := m.Tier(ctx)
+	if err != nil {
+		m.internalError(ctx, err, "Unable to work out the user's tier")
+		return false
+	}
+	if tier >= TierAdmin {
+		return true
+	}
+
+	for i, l := range limiters {
+		if ok, retry := l.Allow(ctx); !ok {
+			for _, allowed := range limiters[:i] {
+				if r, ok := allowed.(Refunder); ok {
+					r.Refund(ctx)
+				}
+			}
+
+			m.rateLimited(ctx, retry)
+			return false
+		}
+	}
+	return true
+}
+
+// commandLimitKey returns the key of the rate limit set for a command.
+func commandLimitKey(name string) string {
+	return "command:" + strings.ToLower(name)
+}
+
+// guildLimitKey returns the key of the rate limit set for a guild.
+func guildLimitKey(guildID string) string {
+	return "guild:" + guildID
+}
+
+// rateLimited lets the user know they've hit the command's rate limit, either
+// with the RateLimited text or by reacting to their message. Each user is only
+// warned once per command until the cooldown is over, so spamming a command
+// doesn't get the bot spamming replies. Slash commands are always replied to,
+// since Discord expects a response.
+func (m *Mux) rateLimited(ctx *Context, retry time.Duration) {
+	options, errorTexts := m.current()
+
+	if ctx.Interaction == nil {
+		m.mu.RLock()
+		warned := m.warned
+		m.mu.RUnlock()
+
+		if retry <= 0 {
+			retry = defaultWarningCooldown
+		}
+
+		key := ctx.Command + ":" + ctx.Message.Author.ID
+		if warned.Add(key, struct{}{}, retry) != nil {
+			return
+		}
+
+		if len(options.RateLimitReaction) != 0 {
+			err := ctx.Session.MessageReactionAdd(
+				ctx.Message.ChannelID, ctx.Message.ID, options.RateLimitReaction,
+			)
+			if err != nil {
+				m.log(func(l logrus.FieldLogger) {
+					l.WithError(err).Warn("Unable to react to rate limited message")
+				})
+			}
+			return
+		}
+	}
+
+	text := errorTexts.RateLimited
+	if strings.Contains(text, "%s") {
+		text = fmt.Sprintf(text, formatCooldown(retry))
+	}
+	ctx.ChannelSend(text)
+}
+
+// formatCooldown describes a cooldown in a user-readable way, rounded up to
+// the second, e.g. "1 minute 30 seconds".
+func formatCooldown(d time.Duration) string {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+
+	var parts []string
+	for _, unit := range []struct {
+		secs int
+		name string
+	}{{3600, "hour"}, {60, "minute"}, {1, "second"}} {
+		n := secs / unit.secs
+		secs %= unit.secs
+
+		switch {
+		case n == 1:
+			parts = append(parts, "1 "+unit.name)
+		case n > 1:
+			parts = append(parts, fmt.Sprintf("%d %ss", n, unit.name))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// limiter returns the rate limiter for the command, if it has one. The older
+// RateLimitMax and RateLimitDB settings are used if RateLimiter isn't set.
+func (cs *CommandSettings) limiter() RateLimiter {
+	if cs.RateLimiter != nil {
+		return cs.RateLimiter
+	}
+
+	if cs.RateLimitDB != nil {
+		return cacheLimiter{cs.RateLimitMax, cs.RateLimitDB}
+	}
+	return nil
+}
+
+// get returns the entry for the key, clearing out entries unused for longer
+// than ttl every so often. Must be called with the lock held.
+func (s *limiterState) get(
+	key string, now time.Time, ttl time.Duration,
+) interface{} {
+	if s.entries == nil {
+		s.entries = make(map[string]interface{})
+		s.used = make(map[string]time.Time)
+	}
+
+	if now.Sub(s.swept) >= ttl {
+		for k, t := range s.used {
+			if now.Sub(t) >= ttl {
+				delete(s.entries, k)
+				delete(s.used, k)
+			}
+		}
+		s.swept = now
+	}
+
+	s.used[key] = now
+	return s.entries[key]
+}
@@ -0,0 +1,132 @@
+package multiplexer
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// limitedMux creates a multiplexer with a ping command, which handles
+// messages without a Discord API.
+func limitedMux(
+	limiter RateLimiter,
+) (*Mux, *discordgo.Session, *sync.WaitGroup) {
+	session, _ := discordgo.New("Bot token")
+	session.State.User = &discordgo.User{ID: "app"}
+	session.Client = &http.Client{Transport: replyTransport{}}
+
+	handled := &sync.WaitGroup{}
+	m, _ := New("!")
+	m.SetOptions(&Options{IgnoreBots: true, IgnoreEmpty: true})
+	m.Register(testCommand{
+		settings: &CommandSettings{Command: "ping", RateLimiter: limiter},
+		handle:   func(ctx *Context) { handled.Done() },
+	})
+	m.Initialize()
+	return m, session, handled
+}
+
+// waitGroup waits for every command to be handled.
+func waitGroup(t *testing.T, wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	waitFor(t, done)
+}
+
+// userMessage builds a message sent by the given member of a guild.
+func userMessage(userID, content string) *discordgo.MessageCreate {
+	msg := guildMessage(0, content)
+	msg.Author = &discordgo.User{ID: userID}
+	msg.Member = &discordgo.Member{}
+	return msg
+}
+
+func TestRateLimitsSkipDeniedUsers(t *testing.T) {
+	m, session, handled := limitedMux(nil)
+	m.SetPermissions(map[string]*CommandPermissions{
+		"ping": {UserIDs: []string{"allowed"}},
+	})
+	m.SetRateLimits(&RateLimits{Guilds: map[string]LimitSpec{
+		"guild": {
+			Type: LimitFixedWindow, Limit: 2, Window: time.Minute,
+			Scope: ScopeGuild,
+		},
+	}})
+
+	/* Someone who can't use the command spams it */
+	for i := 0; i < 10; i++ {
+		m.Handle(session, userMessage("denied", "!ping"))
+	}
+
+	handled.Add(2)
+	m.Handle(session, userMessage("allowed", "!ping"))
+	m.Handle(session, userMessage("allowed", "!ping"))
+	waitGroup(t, handled)
+}
+
+func TestRateLimitsRefund(t *testing.T) {
+	own := NewFixedWindow(5, time.Minute, ScopeUser)
+	m, session, handled := limitedMux(own)
+	m.SetRateLimits(&RateLimits{Commands: map[string]LimitSpec{
+		"ping": {
+			Type: LimitSlidingWindow, Limit: 1, Window: time.Minute,
+			Scope: ScopeUser,
+		},
+	}})
+
+	handled.Add(1)
+	for i := 0; i < 3; i++ {
+		m.Handle(session, userMessage("user", "!ping"))
+	}
+	waitGroup(t, handled)
+
+	/* Only the use which was let through counts towards the command's own
+	   limiter */
+	ctx := &Context{Message: userMessage("user", "!ping")}
+	for i := 0; i < 4; i++ {
+		if ok, _ := own.Allow(ctx); !ok {
+			t.Fatalf("expected use %d to be allowed", i+2)
+		}
+	}
+	if ok, _ := own.Allow(ctx); ok {
+		t.Error("expected the limiter to be used up")
+	}
+}
+
+func TestRefund(t *testing.T) {
+	ctx := &Context{Message: userMessage("user", "!ping")}
+
+	tests := map[string]interface {
+		RateLimiter
+		Refunder
+	}{
+		"fixed window":   NewFixedWindow(1, time.Minute, ScopeUser),
+		"sliding window": NewSlidingWindow(1, time.Minute, ScopeUser),
+		"token bucket":   NewTokenBucket(1, time.Minute, ScopeUser),
+	}
+
+	for name, l := range tests {
+		t.Run(name, func(t *testing.T) {
+			/* Refunding before any use does nothing */
+			l.Refund(ctx)
+
+			if ok, _ := l.Allow(ctx); !ok {
+				t.Fatal("expected the first use to be allowed")
+			}
+			if ok, _ := l.Allow(ctx); ok {
+				t.Fatal("expected the second use to be denied")
+			}
+
+			l.Refund(ctx)
+			if ok, _ := l.Allow(ctx); !ok {
+				t.Error("expected the refunded use to be allowed again")
+			}
+		})
+	}
+}
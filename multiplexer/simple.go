@@ -0,0 +1,280 @@
+package multiplexer
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// SimpleData is what the templates of simple commands are executed with, e.g.
+// "Welcome {{.Mention}} to {{.Guild}}!" or "Hi {{arg 0}}".
+type SimpleData struct {
+	/* The username and mention of whoever used the command */
+	Author, AuthorID, Mention string
+
+	/* The channel's mention (which shows as its name) and ID */
+	Channel, ChannelID string
+
+	/* The guild's name (if it's cached) and ID, empty in DMs */
+	Guild, GuildID string
+
+	Prefix, Command string
+	Args            []string
+	RawArgs         string
+}
+
+const (
+	/* Discord's limits on the length (in characters) of each piece of text
+	   in a message, which templates can't write past */
+	maxContent          = 2000
+	maxEmbedTitle       = 256
+	maxEmbedDescription = 4096
+	maxFieldName        = 256
+	maxFieldValue       = 1024
+	maxFooter           = 2048
+)
+
+// templateText is a piece of text in a simple command's reply which is
+// executed as a template, along with the most characters it can hold.
+type templateText struct {
+	text  *string
+	limit int
+}
+
+var (
+	/* Picks the random responses of simple commands */
+	simpleRand     = rand.New(rand.NewSource(time.Now().UnixNano()))
+	simpleRandLock sync.Mutex
+)
+
+// ParseTemplate parses the template of a simple command. Along with the
+// built-in functions, templates can use `arg n` to get the nth argument
+// (starting from 0), or nothing if there isn't one.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("simple").Funcs(argFuncs(nil)).Parse(text)
+}
+
+// CheckUntrustedTemplate checks a template which anyone could have written
+// (such as in a guild config edited at runtime) can't keep the bot busy.
+// Along with the checks of ParseTemplate, range and template actions (and so
+// loops and recursion) aren't allowed.
+func CheckUntrustedTemplate(text string) error {
+	tmpl, err := ParseTemplate(text)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if err := checkActions(t.Tree.Root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Message builds the message to send in reply to a simple command. If it has
+// Responses, one of them is picked at random in place of Content. For
+// templated commands, the content and the text of the embed are executed as
+// templates with the context's SimpleData.
+func (s SimpleCommand) Message(ctx *Context) (*discordgo.MessageSend, error) {
+	content := s.Content
+	if len(s.Responses) > 0 {
+		simpleRandLock.Lock()
+		content = s.Responses[simpleRand.Intn(len(s.Responses))]
+		simpleRandLock.Unlock()
+	}
+
+	msg := &discordgo.MessageSend{Content: content}
+	if s.Embed != nil {
+		embed := *s.Embed
+		embed.Fields = make([]*discordgo.MessageEmbedField, len(s.Embed.Fields))
+		for i, f := range s.Embed.Fields {
+			field := *f
+			embed.Fields[i] = &field
+		}
+		if s.Embed.Footer != nil {
+			footer := *s.Embed.Footer
+			embed.Footer = &footer
+		}
+		msg.Embeds = []*discordgo.MessageEmbed{&embed}
+	}
+
+	if !s.Template {
+		return msg, nil
+	}
+
+	/* Arguments can't be used to ping @everyone or roles */
+	msg.AllowedMentions = &discordgo.MessageAllowedMentions{
+		Parse: []discordgo.AllowedMentionType{
+			discordgo.AllowedMentionTypeUsers,
+		},
+	}
+
+	/* Execute every piece of text which can be templated */
+	texts := []templateText{{&msg.Content, maxContent}}
+	if len(msg.Embeds) > 0 {
+		embed := msg.Embeds[0]
+		texts = append(texts,
+			templateText{&embed.Title, maxEmbedTitle},
+			templateText{&embed.Description, maxEmbedDescription},
+		)
+		for _, f := range embed.Fields {
+			texts = append(texts,
+				templateText{&f.Name, maxFieldName},
+				templateText{&f.Value, maxFieldValue},
+			)
+		}
+		if embed.Footer != nil {
+			texts = append(texts, templateText{&embed.Footer.Text, maxFooter})
+		}
+	}
+
+	data := simpleData(ctx)
+	for _, t := range texts {
+		out, err := executeTemplate(*t.text, data, t.limit)
+		if err != nil {
+			return nil, err
+		}
+		*t.text = out
+	}
+
+	return msg, nil
+}
+
+/* === Helper Functions === */
+
+// sendSimple sends the reply to a simple command.
+func (m *Mux) sendSimple(ctx *Context, s SimpleCommand) {
+	msg, err := s.Message(ctx)
+	if err != nil {
+		m.internalError(ctx, err, "Unable to build simple command reply")
+		return
+	}
+
+	_, err = ctx.Session.ChannelMessageSendComplex(ctx.Message.ChannelID, msg)
+	if err != nil {
+		m.log(func(l logrus.FieldLogger) {
+			l.WithError(err).Warn("Unable to send simple command reply")
+		})
+	}
+}
+
+// simpleData collects the values a simple command's templates can use.
+func simpleData(ctx *Context) SimpleData {
+	author := ctx.Message.Author
+	data := SimpleData{
+		Author:    author.Username,
+		AuthorID:  author.ID,
+		Mention:   author.Mention(),
+		Channel:   "<#" + ctx.Message.ChannelID + ">",
+		ChannelID: ctx.Message.ChannelID,
+		GuildID:   ctx.Message.GuildID,
+		Prefix:    ctx.Prefix,
+		Command:   ctx.Command,
+		Args:      ctx.Arguments,
+		RawArgs:   ctx.RawArguments,
+	}
+
+	if len(data.GuildID) > 0 && ctx.Session.State != nil {
+		if g, err := ctx.Session.State.Guild(data.GuildID); err == nil {
+			data.Guild = g.Name
+		}
+	}
+	return data
+}
+
+// argFuncs returns the template functions which depend on the arguments.
+func argFuncs(args []string) template.FuncMap {
+	return template.FuncMap{
+		"arg": func(n int) string {
+			if n < 0 || n >= len(args) {
+				return ""
+			}
+			return args[n]
+		},
+	}
+}
+
+// executeTemplate executes a single template, leaving empty text alone. The
+// template is stopped (with an error) as soon as it writes more than limit
+// characters.
+func executeTemplate(text string, data SimpleData, limit int) (string, error) {
+	if len(text) == 0 {
+		return text, nil
+	}
+
+	tmpl, err := ParseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	out := &cappedWriter{limit: limit}
+	if err := tmpl.Funcs(argFuncs(data.Args)).Execute(out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// cappedWriter is a buffer which refuses to hold more than limit characters.
+type cappedWriter struct {
+	buf           bytes.Buffer
+	limit, length int
+}
+
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	w.length += utf8.RuneCount(p)
+	if w.length > w.limit {
+		return 0, fmt.Errorf(
+			"template output is longer than %d characters", w.limit,
+		)
+	}
+	return w.buf.Write(p)
+}
+
+// String returns what's been written so far.
+func (w *cappedWriter) String() string {
+	return w.buf.String()
+}
+
+// checkActions looks for range and template actions in a parsed template.
+func checkActions(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkActions(child); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return fmt.Errorf("range actions can't be used here")
+	case *parse.TemplateNode:
+		return fmt.Errorf("template actions can't be used here")
+	}
+	return nil
+}
+
+// checkBranch checks both branches of an if or with action.
+func checkBranch(n *parse.BranchNode) error {
+	if err := checkActions(n.List); err != nil {
+		return err
+	}
+	return checkActions(n.ElseList)
+}
@@ -0,0 +1,134 @@
+package multiplexer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// simpleContext builds the context of a simple command used in a guild.
+func simpleContext(args ...string) *Context {
+	session, _ := discordgo.New("Bot token")
+	return &Context{
+		Prefix:    "!",
+		Command:   "test",
+		Arguments: args,
+		Session:   session,
+		Message: &discordgo.MessageCreate{Message: &discordgo.Message{
+			ChannelID: "channel",
+			GuildID:   "guild",
+			Author:    &discordgo.User{ID: "user", Username: "someone"},
+		}},
+	}
+}
+
+func TestSimpleMessage(t *testing.T) {
+	s := SimpleCommand{
+		Command:  "test",
+		Content:  "Hi {{.Author}}, you said {{arg 0}}",
+		Template: true,
+		Embed: &discordgo.MessageEmbed{
+			Title:  "{{.Prefix}}{{.Command}}",
+			Fields: []*discordgo.MessageEmbedField{{Name: "{{arg 1}}"}},
+			Footer: &discordgo.MessageEmbedFooter{Text: "{{.ChannelID}}"},
+		},
+	}
+
+	msg, err := s.Message(simpleContext("hello", "field"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embed := msg.Embeds[0]
+	got := []string{
+		msg.Content, embed.Title, embed.Fields[0].Name, embed.Footer.Text,
+	}
+	expected := []string{
+		"Hi someone, you said hello", "!test", "field", "channel",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	/* The original embed is left alone */
+	if s.Embed.Title != "{{.Prefix}}{{.Command}}" {
+		t.Errorf("expected the embed not to be changed, got %q", s.Embed.Title)
+	}
+}
+
+func TestSimpleMessageLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		command SimpleCommand
+		fails   bool
+	}{
+		{
+			name:    "content at the limit",
+			command: SimpleCommand{Content: strings.Repeat("é", maxContent)},
+		},
+		{
+			name: "content over the limit",
+			command: SimpleCommand{
+				Content: `{{range 1000000000}}spam{{end}}`,
+			},
+			fails: true,
+		},
+		{
+			name: "description over the limit",
+			command: SimpleCommand{Embed: &discordgo.MessageEmbed{
+				Description: `{{range 5000}}x{{end}}`,
+			}},
+			fails: true,
+		},
+		{
+			name: "description under the limit",
+			command: SimpleCommand{Embed: &discordgo.MessageEmbed{
+				Description: "{{arg 0}}{{arg 0}}",
+			}},
+		},
+		{
+			name: "long arguments",
+			command: SimpleCommand{
+				Content: "{{arg 0}}{{arg 0}}",
+			},
+			fails: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.command.Command = "test"
+			tt.command.Template = true
+
+			_, err := tt.command.Message(simpleContext(strings.Repeat("a", 1500)))
+			if tt.fails && err == nil {
+				t.Error("expected the reply to be too long")
+			} else if !tt.fails && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckUntrustedTemplate(t *testing.T) {
+	tests := map[string]bool{
+		"Hi {{.Mention}}": true,
+		"{{if .Guild}}in {{.Guild}}{{else}}DM{{end}}": true,
+		"{{with arg 0}}{{.}}{{end}}":                  true,
+		"{{range .Args}}{{.}}{{end}}":                 false,
+		"{{if .Guild}}{{range 10}}x{{end}}{{end}}":    false,
+		`{{define "a"}}{{template "a"}}{{end}}`:       false,
+		`{{block "a" .}}x{{end}}`:                     false,
+		"{{.Broken":                                   false,
+	}
+
+	for text, ok := range tests {
+		err := CheckUntrustedTemplate(text)
+		if ok && err != nil {
+			t.Errorf("expected %q to be allowed, got %v", text, err)
+		} else if !ok && err == nil {
+			t.Errorf("expected %q to be rejected", text)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package multiplexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
+)
+
+// CommandGroup is a command with no logic of its own which exists only to hold
+// subcommands (e.g. `!role add`, `!role remove`). When called without a
+// matching subcommand, it replies with the usage of each of its children.
+type CommandGroup struct {
+	Command  string
+	HelpText string
+
+	Subcommands []Command
+}
+
+// Init is called by the multiplexer before the bot starts. The subcommands of
+// the group are initialized by the multiplexer itself.
+func (g CommandGroup) Init(m *Mux) {
+	// Nothing to init
+}
+
+// Handle is called by the multiplexer when the group is called without a
+// valid subcommand.
+func (g CommandGroup) Handle(ctx *Context) {
+	g.HandleHelp(ctx)
+}
+
+// HandleHelp lists the subcommands of the group along with their help text.
+func (g CommandGroup) HandleHelp(ctx *Context) {
+	var sb strings.Builder
+	sb.WriteString(g.HelpText + "\n")
+
+	for _, c := range g.Subcommands {
+		s := c.Settings()
+		sb.WriteString(
+			"- `" + s.Usage(ctx.Prefix+ctx.Command+" ") + "` " + s.HelpText + "\n",
+		)
+	}
+
+	ctx.ChannelSend(sb.String())
+}
+
+// Settings returns the settings of the group.
+func (g CommandGroup) Settings() *CommandSettings {
+	return &CommandSettings{
+		Command:     g.Command,
+		HelpText:    g.HelpText,
+		Subcommands: g.Subcommands,
+	}
+}
+
+/* === Helper Functions === */
+
+// resolve walks the subcommand tree of a command, descending into the child
+// matching each argument in turn. Returns the deepest matching command, the
+// names of the subcommands taken to reach it, and the remaining arguments.
+func resolve(c Command, args []string) (Command, []string, []string) {
+	var path []string
+
+	for len(args) > 0 {
+		child, ok := findSubcommand(c, args[0])
+		if !ok {
+			break
+		}
+
+		c = child
+		path = append(path, strings.ToLower(child.Settings().Command))
+		args = args[1:]
+	}
+
+	return c, path, args
+}
+
+// findSubcommand looks up a direct child of a command by name or alias.
+func findSubcommand(c Command, name string) (Command, bool) {
+	for _, child := range c.Settings().Subcommands {
+		s := child.Settings()
+		if strings.EqualFold(s.Command, name) ||
+			util.ArrayContains(s.Aliases, strings.ToLower(name), true) {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+// checkTree validates the argument specifications of a command and all of its
+// subcommands, returning a description of each problem found.
+func checkTree(path string, c Command) []string {
+	var errs []string
+	settings := c.Settings()
+
+	if err := validateArguments(settings.Arguments); err != nil {
+		errs = append(errs, fmt.Sprintf("%q: %s", path, err))
+	}
+
+	for _, child := range settings.Subcommands {
+		name := strings.ToLower(child.Settings().Command)
+		errs = append(errs, checkTree(path+" "+name, child)...)
+	}
+	return errs
+}
+
+// initTree calls the init function of a command and all of its subcommands.
+func initTree(m *Mux, c Command) {
+	c.Init(m)
+
+	for _, child := range c.Settings().Subcommands {
+		initTree(m, child)
+	}
+}
@@ -0,0 +1,94 @@
+package multiplexer
+
+import (
+	"strings"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Tier is the level of trust given to the user calling a command. Owners and
+// guild administrators bypass permission rules and rate limits, and only
+// owners can use commands marked OwnerOnly.
+type Tier int
+
+// User tiers, in increasing order of trust
+const (
+	TierUser Tier = iota
+	TierAdmin
+	TierOwner
+)
+
+// SetOwners sets the user IDs of the bot's owners.
+func (m *Mux) SetOwners(ids ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.owners = ids
+}
+
+// IsOwner checks if the user ID belongs to one of the bot's owners.
+func (m *Mux) IsOwner(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return util.ArrayContains(m.owners, id, false)
+}
+
+// Tier returns the tier of the user who sent the message. Members with the
+// Administrator permission are only treated as admins if the AdminOverride
+// option is enabled. The tier is only worked out once per context.
+func (m *Mux) Tier(ctx *Context) (Tier, error) {
+	if ctx.tier != nil {
+		return *ctx.tier, nil
+	}
+
+	tier := TierUser
+	options, _ := m.current()
+
+	switch {
+	case m.IsOwner(ctx.Message.Author.ID):
+		tier = TierOwner
+
+	case options.AdminOverride && ctx.Message.GuildID != "":
+		perms, err := ctx.MemberPermissions()
+		if err != nil {
+			return TierUser, err
+		}
+
+		if perms&discordgo.PermissionAdministrator != 0 {
+			tier = TierAdmin
+		}
+	}
+
+	ctx.tier = &tier
+	return tier, nil
+}
+
+/* === Helper Functions === */
+
+// ownerOnly checks if the command at the given path, or any of its parents,
+// can only be used by the bot's owners.
+func (m *Mux) ownerOnly(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+
+	m.mu.RLock()
+	c, ok := m.commands[strings.ToLower(path[0])]
+	m.mu.RUnlock()
+
+	for i := 1; ok; i++ {
+		if c.Settings().OwnerOnly {
+			return true
+		}
+
+		if i >= len(path) {
+			break
+		}
+		c, ok = findSubcommand(c, path[i])
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package multiplexer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits the argument portion of a message into individual
+// arguments. Runs of whitespace separate arguments, single or double quotes
+// group text (including whitespace) into one argument, a backslash escapes the
+// character following it, and code blocks (`code` or ```code```) are kept as a
+// single argument with their contents untouched. Writing a quote twice inside
+// quotes of the same kind includes it, and the language of a multi-line code
+// block (```go) isn't part of its contents. Quotes and code blocks are only
+// recognized at the start of an argument and are treated literally if they
+// are never closed, so things like "don't" work as expected.
+func Tokenize(input string) []string {
+	var (
+		tokens  []string
+		sb      strings.Builder
+		inToken bool
+	)
+
+	runes := []rune(input)
+
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, sb.String())
+		}
+		sb.Reset()
+		inToken = false
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+
+		case r == '\\':
+			/* Escape the next character, or keep a trailing backslash */
+			if i+1 < len(runes) {
+				i++
+				sb.WriteRune(runes[i])
+			} else {
+				sb.WriteRune(r)
+			}
+			inToken = true
+
+		case (r == '"' || r == '\'') && !inToken:
+			end, content, ok := readQuoted(runes, i)
+			if !ok {
+				sb.WriteRune(r)
+				inToken = true
+				continue
+			}
+
+			sb.WriteString(content)
+			inToken = true
+			i = end
+
+		case r == '`' && !inToken:
+			end, content, ok := readCode(runes, i)
+			if !ok {
+				sb.WriteRune(r)
+				inToken = true
+				continue
+			}
+
+			sb.WriteString(content)
+			inToken = true
+			i = end
+
+		default:
+			sb.WriteRune(r)
+			inToken = true
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+/* === Helper Functions === */
+
+// splitCommand separates the command name from the rest of a message (with
+// the prefix already removed). The returned arguments are left untouched
+// apart from the whitespace separating them from the command.
+func splitCommand(content string) (string, string) {
+	i := strings.IndexFunc(content, unicode.IsSpace)
+	if i == -1 {
+		return content, ""
+	}
+
+	return content[:i], strings.TrimLeftFunc(content[i:], unicode.IsSpace)
+}
+
+// readQuoted reads a quoted string starting at the opening quote located at
+// start. Returns the index of the closing quote, the unescaped content, and
+// whether or not a closing quote was found.
+func readQuoted(runes []rune, start int) (int, string, bool) {
+	var sb strings.Builder
+	quote := runes[start]
+
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			sb.WriteRune(runes[i])
+		case quote:
+			/* A doubled quote is a quote, not the end of the string */
+			if i+1 < len(runes) && runes[i+1] == quote {
+				i++
+				sb.WriteRune(quote)
+				continue
+			}
+			return i, sb.String(), true
+		default:
+			sb.WriteRune(runes[i])
+		}
+	}
+
+	return start, "", false
+}
+
+// readCode reads an inline (`) or multi-line (```) code block starting at the
+// opening fence located at start. Returns the index of the last rune of the
+// closing fence, the verbatim content (without the language of a multi-line
+// block), and whether or not a closing fence was found.
+func readCode(runes []rune, start int) (int, string, bool) {
+	fence := "`"
+	if strings.HasPrefix(string(runes[start:]), "```") {
+		fence = "```"
+	}
+
+	body := string(runes[start+len(fence):])
+	end := strings.Index(body, fence)
+	if end == -1 {
+		return start, "", false
+	}
+
+	content := body[:end]
+	last := start + len(fence) + len([]rune(content)) + len(fence) - 1
+
+	/* Like Discord, treat a first line without spaces as the language */
+	if fence == "```" {
+		if i := strings.IndexByte(content, '\n'); i >= 0 && strings.IndexFunc(
+			strings.TrimSuffix(content[:i], "\r"), unicode.IsSpace,
+		) == -1 {
+			content = content[i+1:]
+		}
+	}
+	return last, content, true
+}
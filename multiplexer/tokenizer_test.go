@@ -0,0 +1,65 @@
+package multiplexer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name, input string
+		expected    []string
+	}{
+		{"empty", "", nil},
+		{"whitespace", " \t\n ", nil},
+		{"words", "one  two\tthree\nfour", []string{"one", "two", "three", "four"}},
+		{"double quotes", `say "hello there" now`, []string{"say", "hello there", "now"}},
+		{"single quotes", `'hello there'`, []string{"hello there"}},
+		{"empty quotes", `"" ''`, []string{"", ""}},
+		{"quotes mid word", `don't "stop"`, []string{"don't", "stop"}},
+		{"unclosed quote", `"hello there`, []string{`"hello`, "there"}},
+		{"other quote inside", `"it's" '"hi"'`, []string{"it's", `"hi"`}},
+		{"doubled single quote", `'it''s'`, []string{"it's"}},
+		{"doubled double quote", `"say ""hi"""`, []string{`say "hi"`}},
+		{"only a doubled quote", `''''`, []string{"'"}},
+		{"escaped quote", `"say \"hi\""`, []string{`say "hi"`}},
+		{"escaped space", `hello\ there`, []string{"hello there"}},
+		{"trailing backslash", `end\`, []string{`end\`}},
+		{"inline code", "`a  b` c", []string{"a  b", "c"}},
+		{"code keeps quotes", "`\"x\" \\n`", []string{`"x" \n`}},
+		{"unclosed code", "`a b", []string{"`a", "b"}},
+		{"code block", "```\nline one\nline two```", []string{"line one\nline two"}},
+		{"code block language", "```go\nfmt.Println(\"hi\")\n```", []string{"fmt.Println(\"hi\")\n"}},
+		{"code block language crlf", "```json\r\n{}```", []string{"{}"}},
+		{"code block first line", "```a b\nc```", []string{"a b\nc"}},
+		{"single line code block", "```go```", []string{"go"}},
+		{"code block then word", "```x``` y", []string{"x", "y"}},
+		{"unicode", `"héllo wörld" ✓`, []string{"héllo wörld", "✓"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.input); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		content, command, rest string
+	}{
+		{"ping", "ping", ""},
+		{"ping  a b", "ping", "a b"},
+		{"ping\n```\ncode```", "ping", "```\ncode```"},
+	}
+
+	for _, tt := range tests {
+		command, rest := splitCommand(tt.content)
+		if command != tt.command || rest != tt.rest {
+			t.Errorf("%q: expected %q and %q, got %q and %q",
+				tt.content, tt.command, tt.rest, command, rest)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package reload
+
+import (
+	"fmt"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/config"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
+)
+
+// guildCollection is the storage collection guild configs edited at runtime
+// are kept in, keyed by guild ID.
+const guildCollection = "guilds"
+
+// GuildConfig returns the config in use for a guild, or nil if it doesn't have
+// one, along with whether it was edited at runtime rather than coming from the
+// config file.
+func (r *Reloader) GuildConfig(guildID string) (*config.GuildConfig, bool, error) {
+	edited, err := r.editedGuild(guildID)
+	if err != nil || edited != nil {
+		return edited, edited != nil, err
+	}
+
+	return r.Config().Guilds[guildID], false, nil
+}
+
+// SetGuildConfig saves a guild config edited at runtime and applies it
+// straight away. It's used in place of the guild's entry in the config file
+// (even after reloading) until ResetGuildConfig is called.
+func (r *Reloader) SetGuildConfig(guildID string, g *config.GuildConfig) error {
+	store := r.Mux.Storage()
+	if store == nil {
+		return fmt.Errorf("no storage has been set up to save guild configs in")
+	}
+
+	guilds, err := store.Collection(guildCollection)
+	if err != nil {
+		return err
+	}
+
+	data, err := g.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	if err := guilds.Set(guildID, data); err != nil {
+		return err
+	}
+
+	r.Mux.SetGuild(guildID, guildSettings(g))
+	return nil
+}
+
+// ResetGuildConfig discards the edits made to a guild's config at runtime, so
+// its entry in the config file (if any) is used again.
+func (r *Reloader) ResetGuildConfig(guildID string) error {
+	if store := r.Mux.Storage(); store != nil {
+		guilds, err := store.Collection(guildCollection)
+		if err != nil {
+			return err
+		}
+
+		if err := guilds.Delete(guildID); err != nil {
+			return err
+		}
+	}
+
+	r.Mux.SetGuild(guildID, guildSettings(r.Config().Guilds[guildID]))
+	return nil
+}
+
+/* === Helper Functions === */
+
+// guilds builds the settings of every guild in a config, using the edited
+// configs in storage in place of those in the config file. Guilds whose
+// edited config can't be read keep the one in the config file, with the error
+// returned along with the rest.
+func (r *Reloader) guilds(
+	cfg *config.BotConfig,
+) (map[string]*multiplexer.GuildSettings, error) {
+	guilds := make(map[string]*multiplexer.GuildSettings)
+	for id, g := range cfg.Guilds {
+		guilds[id] = guildSettings(g)
+	}
+
+	var err error
+	if r.Mux.Storage() != nil {
+		err = r.eachEditedGuild(func(id string, g *config.GuildConfig) {
+			guilds[id] = guildSettings(g)
+		})
+	}
+	return guilds, err
+}
+
+// editedGuild returns the edited config of a guild from storage, or nil if
+// it hasn't been edited.
+func (r *Reloader) editedGuild(guildID string) (*config.GuildConfig, error) {
+	store := r.Mux.Storage()
+	if store == nil {
+		return nil, nil
+	}
+
+	guilds, err := store.Collection(guildCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok, err := guilds.Get(guildID)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return config.ParseGuild(string(data))
+}
+
+// eachEditedGuild calls fn with the edited config of each guild in storage.
+// Guilds whose config can't be read are skipped, with the error returned once
+// the rest have been read.
+func (r *Reloader) eachEditedGuild(fn func(string, *config.GuildConfig)) error {
+	guilds, err := r.Mux.Storage().Collection(guildCollection)
+	if err != nil {
+		return err
+	}
+
+	ids, err := guilds.Keys()
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, id := range ids {
+		g, err := r.editedGuild(id)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("guild %q: %w", id, err)
+			}
+			continue
+		}
+		if g != nil {
+			fn(id, g)
+		}
+	}
+	return firstErr
+}
+
+// guildSettings converts a guild config into settings for the multiplexer.
+func guildSettings(g *config.GuildConfig) *multiplexer.GuildSettings {
+	if g == nil {
+		return nil
+	}
+
+	settings := &multiplexer.GuildSettings{
+		Prefixes:    g.Prefixes,
+		Permissions: g.Permissions,
+		Disabled:    g.DisabledCommands,
+	}
+
+	for _, s := range g.SimpleCommands {
+		settings.SimpleCommands = append(settings.SimpleCommands, s)
+	}
+
+	return settings
+}
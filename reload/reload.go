@@ -0,0 +1,247 @@
+package reload
+
+import (
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/config"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/log"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/util"
+)
+
+// Reloader re-fetches the config while the bot is running and swaps the
+// simple commands and permissions it defines into the multiplexer. Reloads are
+// triggered by SIGHUP, changes to a local config file, a timer for remote
+// configs, or by calling Reload directly.
+type Reloader struct {
+	Path   string
+	Mux    *multiplexer.Mux
+	Logger *log.Logs
+
+	/* The directory whose *.json files are merged into the config */
+	IncludeDir string
+
+	/* Owners which aren't in the config (e.g. from the environment) */
+	Owners []string
+
+	/* How often a local config file is checked for changes, and how often a
+	   remote config is re-fetched. Zero disables checking */
+	FileInterval time.Duration
+	URLInterval  time.Duration
+
+	cfg     *config.BotConfig
+	cfgLock sync.RWMutex
+
+	/* Serializes reloads */
+	reloadLock sync.Mutex
+	files      string
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+// New creates a new Reloader for the config at the given path, starting with
+// the config which has already been loaded.
+func New(
+	path string, cfg *config.BotConfig, mux *multiplexer.Mux, logs *log.Logs,
+) *Reloader {
+	r := &Reloader{
+		Path:         path,
+		Mux:          mux,
+		Logger:       logs,
+		IncludeDir:   cfg.IncludeDir,
+		FileInterval: 5 * time.Second,
+		URLInterval:  5 * time.Minute,
+		cfg:          cfg,
+		stop:         make(chan struct{}),
+	}
+	r.files = r.fileState()
+
+	return r
+}
+
+// Config returns the config currently in use.
+func (r *Reloader) Config() *config.BotConfig {
+	r.cfgLock.RLock()
+	defer r.cfgLock.RUnlock()
+
+	return r.cfg
+}
+
+// Apply swaps the simple commands, permissions, owners, rate limits and guild
+// configs from the supplied config into the multiplexer all at once, and makes
+// it the current config. Returns an error if any of the simple commands
+// collide with other commands, though the rest are still applied.
+func (r *Reloader) Apply(cfg *config.BotConfig) error {
+	var simple []multiplexer.SimpleCommand
+	for _, s := range cfg.SimpleCommands {
+		simple = append(simple, s)
+	}
+
+	owners := make([]string, 0, len(r.Owners)+len(cfg.Owners))
+	owners = append(owners, r.Owners...)
+	owners = append(owners, cfg.Owners...)
+
+	guilds, gerr := r.guilds(cfg)
+	if gerr != nil {
+		r.Logger.Config.WithError(gerr).Warn("Unable to load edited guild configs")
+	}
+
+	err := r.Mux.SetConfig(&multiplexer.Config{
+		Owners:         owners,
+		SimpleCommands: simple,
+		Permissions:    cfg.Permissions,
+		RateLimits:     cfg.RateLimits,
+		Guilds:         guilds,
+	})
+
+	r.cfgLock.Lock()
+	r.cfg = cfg
+	r.cfgLock.Unlock()
+
+	return err
+}
+
+// Reload fetches and applies the config. If the config can't be loaded, the
+// current one is kept, and if it hasn't changed nothing is applied.
+func (r *Reloader) Reload() error {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	cfg, err := config.Load(r.Path, r.IncludeDir)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range cfg.Warnings {
+		r.Logger.Config.Warn("Config problem: " + w.String())
+	}
+
+	/* Remote configs are fetched on a timer, and usually haven't changed */
+	if cfg.Equal(r.Config()) {
+		r.files = r.fileState()
+		r.Logger.Config.Debug("Config hasn't changed")
+		return nil
+	}
+
+	if err := r.Apply(cfg); err != nil {
+		r.Logger.Config.WithError(err).Warn("Problem applying reloaded config")
+	}
+
+	/* Files may have been included or removed */
+	r.files = r.fileState()
+
+	r.Logger.Config.Info("Config reloaded")
+	return nil
+}
+
+// Watch starts reloading the config whenever the bot receives a SIGHUP, and
+// whenever the config changes (for local files) or periodically (for URLs).
+// Runs until Stop is called.
+func (r *Reloader) Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	interval := r.FileInterval
+	if util.IsURL(r.Path) {
+		interval = r.URLInterval
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-hup:
+				r.Logger.Config.Info("Received SIGHUP, reloading config")
+				r.reload()
+
+			case <-tick:
+				if r.changed() {
+					r.reload()
+				}
+
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops watching for changes to the config. It's safe to call more than
+// once.
+func (r *Reloader) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+/* === Helper Functions === */
+
+// reload reloads the config, logging any errors.
+func (r *Reloader) reload() {
+	if err := r.Reload(); err != nil {
+		r.Logger.Config.WithError(err).Error(
+			"Unable to reload config, keeping the current one",
+		)
+	}
+}
+
+// changed checks if the config should be reloaded. Remote configs are always
+// reloaded, while local files are only reloaded if any of them (or the files
+// in the include directory) have been modified, added or removed.
+func (r *Reloader) changed() bool {
+	if util.IsURL(r.Path) {
+		return true
+	}
+
+	files := r.fileState()
+
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	if files == r.files {
+		return false
+	}
+	r.files = files
+	return true
+}
+
+// fileState describes the local files making up the config (the name and
+// modification time of each), so changes to any of them can be spotted.
+func (r *Reloader) fileState() string {
+	files := []string{r.Path}
+	if cfg := r.Config(); cfg != nil {
+		files = append(files, cfg.Sources...)
+	}
+	if len(r.IncludeDir) > 0 {
+		matches, _ := config.IncludeFiles(r.IncludeDir)
+		files = append(files, matches...)
+	}
+
+	seen := make(map[string]bool)
+	var state []string
+	for _, file := range files {
+		if seen[file] || util.IsURL(file) {
+			continue
+		}
+		seen[file] = true
+
+		if info, err := os.Stat(file); err == nil {
+			state = append(state, file+"@"+info.ModTime().String())
+		}
+	}
+
+	sort.Strings(state)
+	return strings.Join(state, "\n")
+}
@@ -0,0 +1,93 @@
+package reload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/config"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/log"
+	"github.com/PulseDevelopmentGroup/Build-A-Bot/multiplexer"
+)
+
+// newReloader loads the config at path and applies it to a new multiplexer.
+func newReloader(t *testing.T, path string) *Reloader {
+	cfg, err := config.Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := log.New(false)
+	logs.Primary.SetOutput(ioutil.Discard)
+
+	mux, _ := multiplexer.New("!")
+	r := New(path, cfg, mux, logs)
+	if err := r.Apply(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestStopTwice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{}`))
+		},
+	))
+	defer srv.Close()
+
+	r := newReloader(t, srv.URL+"/config.json")
+	r.Watch()
+	r.Stop()
+	r.Stop()
+}
+
+func TestReloadOnlyAppliesChanges(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		body    = `{"owners": ["1"]}`
+		version = 1
+	)
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			tag := fmt.Sprintf(`"v%d"`, version)
+			if r.Header.Get("If-None-Match") == tag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", tag)
+			w.Write([]byte(body))
+		},
+	))
+	defer srv.Close()
+
+	r := newReloader(t, srv.URL+"/config.json")
+	applied := r.Config()
+
+	/* Nothing has changed, so the owner set here is kept */
+	r.Mux.SetOwners("1", "2")
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Config() != applied || !r.Mux.IsOwner("2") {
+		t.Error("expected the unchanged config not to be applied")
+	}
+
+	mu.Lock()
+	body = `{"owners": ["3"]}`
+	version++
+	mu.Unlock()
+
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Config() == applied || r.Mux.IsOwner("2") || !r.Mux.IsOwner("3") {
+		t.Error("expected the changed config to be applied")
+	}
+}
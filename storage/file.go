@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tempSuffix is added to the name of a collection's file while a new version of
+// it is being written.
+const tempSuffix = ".tmp"
+
+type (
+	// File is a Store which keeps each collection in its own JSON file in a
+	// directory (e.g. under DATA_DIR). Collections are loaded into memory when
+	// first used, and written out in full on every change. Writes go to a
+	// temporary file which replaces the old one once it has been synced to
+	// disk, so a crash leaves either the old or the new version of a
+	// collection, never a mix. Initialized with OpenFile().
+	File struct {
+		*fileCollection
+
+		dir         string
+		mu          sync.Mutex
+		collections map[string]*fileCollection
+		closed      bool
+	}
+
+	fileCollection struct {
+		mu     sync.RWMutex
+		path   string
+		values map[string][]byte
+	}
+)
+
+// OpenFile opens the store in the given directory, creating the directory if
+// it doesn't exist. Any half-written files left behind by a crash are removed.
+func OpenFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	temps, err := filepath.Glob(filepath.Join(dir, "*"+tempSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range temps {
+		if err := os.Remove(t); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &File{dir: dir, collections: make(map[string]*fileCollection)}
+	if f.fileCollection, err = f.load(DefaultCollection); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Collection implements Store. Collection names can contain any characters,
+// which are escaped in the name of the file.
+func (f *File) Collection(name string) (Collection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, ErrClosed
+	}
+
+	if c, ok := f.collections[name]; ok {
+		return c, nil
+	}
+	return f.load(name)
+}
+
+// Close implements Store. Everything has already been written to disk, so
+// this just stops the store from being used.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, c := range f.collections {
+		c.mu.Lock()
+		c.values = nil
+		c.mu.Unlock()
+	}
+	f.closed = true
+	return nil
+}
+
+// Get implements Collection.
+func (c *fileCollection) Get(key string) ([]byte, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.values == nil {
+		return nil, false, ErrClosed
+	}
+
+	v, ok := c.values[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return copyBytes(v), true, nil
+}
+
+// Set implements Collection.
+func (c *fileCollection) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values == nil {
+		return ErrClosed
+	}
+
+	old, existed := c.values[key]
+	c.values[key] = copyBytes(value)
+
+	if err := c.write(); err != nil {
+		/* Keep memory in line with what's on disk */
+		if existed {
+			c.values[key] = old
+		} else {
+			delete(c.values, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete implements Collection.
+func (c *fileCollection) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values == nil {
+		return ErrClosed
+	}
+
+	old, existed := c.values[key]
+	if !existed {
+		return nil
+	}
+	delete(c.values, key)
+
+	if err := c.write(); err != nil {
+		c.values[key] = old
+		return err
+	}
+	return nil
+}
+
+// Keys implements Collection.
+func (c *fileCollection) Keys() ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.values == nil {
+		return nil, ErrClosed
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+/* === Helper Functions === */
+
+// load reads a collection from its file, or starts an empty one if it doesn't
+// exist yet. Must be called with the store's lock held.
+func (f *File) load(name string) (*fileCollection, error) {
+	if len(name) == 0 {
+		return nil, fmt.Errorf("storage: collection name is empty")
+	}
+
+	/* Escape the name so it can't point outside the directory */
+	file := url.PathEscape(name)
+	file = strings.NewReplacer(".", "%2E", "/", "%2F").Replace(file)
+
+	c := &fileCollection{
+		path:   filepath.Join(f.dir, file+".json"),
+		values: make(map[string][]byte),
+	}
+
+	data, err := ioutil.ReadFile(c.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &c.values); err != nil {
+			return nil, fmt.Errorf(
+				"storage: collection %q is corrupt: %w", name, err,
+			)
+		}
+	}
+
+	f.collections[name] = c
+	return c, nil
+}
+
+// write atomically replaces the collection's file with its current values.
+// Must be called with the collection's lock held.
+func (c *fileCollection) write() error {
+	data, err := json.Marshal(c.values)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + tempSuffix
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	/* Sync the directory so the rename itself survives a crash */
+	dir, err := os.Open(filepath.Dir(c.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
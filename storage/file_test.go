@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFileReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := OpenFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guild, err := f.Collection("../guild/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		f.Set("a", []byte("1")),
+		f.Set("b", []byte("2")),
+		f.Delete("b"),
+		SetJSON(guild, "prefixes", []string{"?"}),
+		guild.Set("old", []byte("x")),
+		guild.Delete("old"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	/* Every collection is kept in its own file in the directory */
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("expected 2 files, got %d", len(files))
+	}
+
+	f, err = OpenFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if v, ok, err := f.Get("a"); err != nil || !ok || string(v) != "1" {
+		t.Errorf("expected a to be 1, got %q (%v, %v)", v, ok, err)
+	}
+	if keys, _ := f.Keys(); len(keys) != 1 {
+		t.Errorf("expected only a to be left, got %v", keys)
+	}
+
+	guild, err = f.Collection("../guild/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefixes []string
+	if ok, err := GetJSON(guild, "prefixes", &prefixes); err != nil || !ok ||
+		len(prefixes) != 1 || prefixes[0] != "?" {
+		t.Errorf("expected the prefixes to be kept, got %v (%v, %v)", prefixes, ok, err)
+	}
+	if keys, _ := guild.Keys(); len(keys) != 1 {
+		t.Errorf("expected only prefixes to be left, got %v", keys)
+	}
+}
+
+func TestFileRemovesTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"default.json":              `{"a": "MQ=="}`,
+		"default.json" + tempSuffix: `{"a": "Mg==", "b"`,
+		"guild.json" + tempSuffix:   `{`,
+	}
+	for name, data := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := OpenFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var names []string
+	infos, _ := ioutil.ReadDir(dir)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "default.json" {
+		t.Errorf("expected the temporary files to be removed, got %v", names)
+	}
+
+	/* The last complete version is used */
+	if v, _, _ := f.Get("a"); string(v) != "1" {
+		t.Errorf("expected a to be 1, got %q", v)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "guild.json")); !os.IsNotExist(err) {
+		t.Error("expected no guild collection to be created")
+	}
+}
+
+func TestFileClosed(t *testing.T) {
+	f, err := OpenFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guild, err := f.Collection("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []Collection{f, guild} {
+		_, _, getErr := c.Get("a")
+		_, keysErr := c.Keys()
+		for _, err := range []error{
+			getErr, c.Set("a", nil), c.Delete("a"), keysErr,
+		} {
+			if !errors.Is(err, ErrClosed) {
+				t.Errorf("expected ErrClosed, got %v", err)
+			}
+		}
+	}
+
+	if _, err := f.Collection("other"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import "sync"
+
+type (
+	// Memory is a Store which keeps everything in memory, so nothing is kept
+	// once the bot stops. Useful for development and testing. Initialized with
+	// NewMemory().
+	Memory struct {
+		memoryCollection
+
+		mu          sync.Mutex
+		collections map[string]*memoryCollection
+		closed      bool
+	}
+
+	memoryCollection struct {
+		mu     sync.RWMutex
+		values map[string][]byte
+	}
+)
+
+// NewMemory creates a new in-memory store.
+func NewMemory() *Memory {
+	m := &Memory{collections: make(map[string]*memoryCollection)}
+	m.memoryCollection = memoryCollection{values: make(map[string][]byte)}
+	m.collections[DefaultCollection] = &m.memoryCollection
+	return m
+}
+
+// Collection implements Store.
+func (m *Memory) Collection(name string) (Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	c, ok := m.collections[name]
+	if !ok {
+		c = &memoryCollection{values: make(map[string][]byte)}
+		m.collections[name] = c
+	}
+	return c, nil
+}
+
+// Close implements Store. Everything stored is discarded.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.collections {
+		c.mu.Lock()
+		c.values = nil
+		c.mu.Unlock()
+	}
+	m.closed = true
+	return nil
+}
+
+// Get implements Collection.
+func (c *memoryCollection) Get(key string) ([]byte, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.values == nil {
+		return nil, false, ErrClosed
+	}
+
+	v, ok := c.values[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return copyBytes(v), true, nil
+}
+
+// Set implements Collection.
+func (c *memoryCollection) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values == nil {
+		return ErrClosed
+	}
+
+	c.values[key] = copyBytes(value)
+	return nil
+}
+
+// Delete implements Collection.
+func (c *memoryCollection) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values == nil {
+		return ErrClosed
+	}
+
+	delete(c.values, key)
+	return nil
+}
+
+// Keys implements Collection.
+func (c *memoryCollection) Keys() ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.values == nil {
+		return nil, ErrClosed
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+/* === Helper Functions === */
+
+// copyBytes copies a value so callers can't modify what's stored.
+func copyBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	copy(out, b)
+	return out
+}
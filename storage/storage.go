@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// DefaultCollection is the name of the collection used by a Store's own Get,
+// Set, Delete and Keys methods.
+const DefaultCollection = "default"
+
+// ErrClosed is returned when a store is used after it has been closed.
+var ErrClosed = errors.New("storage: store is closed")
+
+type (
+	// Collection is a namespaced set of keys and values. All of its methods
+	// are safe to call from multiple goroutines.
+	Collection interface {
+		/* Get returns the value of a key, and whether or not it exists */
+		Get(key string) ([]byte, bool, error)
+		Set(key string, value []byte) error
+		Delete(key string) error
+
+		/* Keys returns every key in the collection, in no particular order */
+		Keys() ([]string, error)
+	}
+
+	// Store is a key/value store split into collections (e.g. one per guild or
+	// per command). The store's own methods use DefaultCollection.
+	Store interface {
+		Collection
+
+		/* Collection returns the named collection, creating it if needed */
+		Collection(name string) (Collection, error)
+		Close() error
+	}
+)
+
+// GetJSON reads the value of a key into v. Returns whether or not the key
+// exists.
+func GetJSON(c Collection, key string, v interface{}) (bool, error) {
+	data, ok, err := c.Get(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// SetJSON stores v as the value of a key.
+func SetJSON(c Collection, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Set(key, data)
+}